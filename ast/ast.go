@@ -2,6 +2,9 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/naronA/monkey/mtoken"
 )
@@ -9,6 +12,11 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+
+	// Pos はノードの最初の文字の位置、End はノードの最後の文字の直後の位置を返す
+	// 括弧でくくった式 (a + b) は ParenExpression になり、その範囲は括弧を含む. 文の範囲に末尾の「;」は含まない
+	Pos() mtoken.Position
+	End() mtoken.Position
 }
 
 type Statement interface {
@@ -33,6 +41,22 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+func (p *Program) Pos() mtoken.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return mtoken.Position{}
+}
+
+func (p *Program) End() mtoken.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[len(p.Statements)-1].End()
+	}
+
+	return mtoken.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -53,6 +77,22 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() mtoken.Position {
+	return ls.Token.Pos
+}
+
+func (ls *LetStatement) End() mtoken.Position {
+	if ls.Value != nil {
+		return ls.Value.End()
+	}
+
+	if ls.Name != nil {
+		return ls.Name.End()
+	}
+
+	return ls.Token.End
+}
+
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -69,6 +109,77 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// AssignStatement は x = 1 や a[i] += 1 のような代入文. Operator は =, +=, -=, *=, /= のいずれか
+type AssignStatement struct {
+	Token    mtoken.Token // 代入演算子のトークン
+	Target   Expression   // *Identifier, *IndexExpression または *FieldExpression
+	Operator string
+	Value    Expression
+}
+
+func (as *AssignStatement) statementNode()       {}
+func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
+func (as *AssignStatement) Pos() mtoken.Position {
+	return as.Target.Pos()
+}
+
+func (as *AssignStatement) End() mtoken.Position {
+	if as.Value != nil {
+		return as.Value.End()
+	}
+
+	return as.Token.End
+}
+
+func (as *AssignStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(as.Target.String())
+	out.WriteString(" " + as.Operator + " ")
+
+	if as.Value != nil {
+		out.WriteString(as.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// BadStatement は構文エラーのため解析できなかった文の代わりに置かれる
+type BadStatement struct {
+	Token mtoken.Token // 解析できなかった文の最初のトークン
+}
+
+func (bs *BadStatement) statementNode()       {}
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BadStatement) Pos() mtoken.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BadStatement) End() mtoken.Position {
+	return bs.Token.End
+}
+
+func (bs *BadStatement) String() string { return "<bad statement>" }
+
+// BadExpression は構文エラーのため解析できなかった式の代わりに置かれる
+type BadExpression struct {
+	Token mtoken.Token // 解析できなかった式の最初のトークン
+}
+
+func (be *BadExpression) expressionNode()      {}
+func (be *BadExpression) TokenLiteral() string { return be.Token.Literal }
+func (be *BadExpression) Pos() mtoken.Position {
+	return be.Token.Pos
+}
+
+func (be *BadExpression) End() mtoken.Position {
+	return be.Token.End
+}
+
+func (be *BadExpression) String() string { return "<bad expression>" }
+
 type Identifier struct {
 	Token mtoken.Token // token.IDENT
 	Value string
@@ -78,6 +189,14 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() mtoken.Position {
+	return i.Token.Pos
+}
+
+func (i *Identifier) End() mtoken.Position {
+	return i.Token.End
+}
+
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -91,13 +210,25 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() mtoken.Position {
+	return rs.Token.Pos
+}
+
+func (rs *ReturnStatement) End() mtoken.Position {
+	if rs.ReturnValue != nil {
+		return rs.ReturnValue.End()
+	}
+
+	return rs.Token.End
+}
+
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
-	out.WriteString(rs.TokenLiteral() + " ")
+	out.WriteString(rs.TokenLiteral())
 
 	if rs.ReturnValue != nil {
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(" " + rs.ReturnValue.String())
 	}
 
 	out.WriteString(";")
@@ -115,6 +246,22 @@ func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
 
+func (es *ExpressionStatement) Pos() mtoken.Position {
+	if es.Expression != nil {
+		return es.Expression.Pos()
+	}
+
+	return es.Token.Pos
+}
+
+func (es *ExpressionStatement) End() mtoken.Position {
+	if es.Expression != nil {
+		return es.Expression.End()
+	}
+
+	return es.Token.End
+}
+
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -132,10 +279,80 @@ func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() mtoken.Position {
+	return il.Token.Pos
+}
+
+func (il *IntegerLiteral) End() mtoken.Position {
+	return il.Token.End
+}
+
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+type FloatLiteral struct {
+	Token mtoken.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() mtoken.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FloatLiteral) End() mtoken.Position {
+	return fl.Token.End
+}
+
+func (fl *FloatLiteral) String() string { return fl.Token.Literal }
+
+type StringLiteral struct {
+	Token mtoken.Token // リテラルはエスケープを解釈した後の文字列
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() mtoken.Position {
+	return sl.Token.Pos
+}
+
+func (sl *StringLiteral) End() mtoken.Position {
+	return sl.Token.End
+}
+
+func (sl *StringLiteral) String() string { return quote(sl.Value) }
+
+// quote は字句解析器が読めるエスケープだけを使って文字列をダブルクォートで囲む
+func quote(s string) string {
+	var out bytes.Buffer
+
+	out.WriteByte('"')
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case !unicode.IsPrint(r):
+			out.WriteString(fmt.Sprintf(`\u{%x}`, r))
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	out.WriteByte('"')
+
+	return out.String()
+}
+
 type PrefixExpression struct {
 	Token    mtoken.Token // 前置トークン、例えば「!」
 	Operator string
@@ -144,6 +361,18 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() mtoken.Position {
+	return pe.Token.Pos
+}
+
+func (pe *PrefixExpression) End() mtoken.Position {
+	if pe.Right != nil {
+		return pe.Right.End()
+	}
+
+	return pe.Token.End
+}
+
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -164,6 +393,18 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() mtoken.Position {
+	return oe.Left.Pos()
+}
+
+func (oe *InfixExpression) End() mtoken.Position {
+	if oe.Right != nil {
+		return oe.Right.End()
+	}
+
+	return oe.Token.End
+}
+
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -176,6 +417,61 @@ func (oe *InfixExpression) String() string {
 	return out.String()
 }
 
+// LogicalExpression は && と || . 右辺は左辺の値によっては評価しない (短絡評価) ので
+// InfixExpression とは別のノードにしている
+type LogicalExpression struct {
+	Token    mtoken.Token // 演算子トークン、「&&」または「||」
+	Left     Expression
+	Operator string
+	Right    Expression
+}
+
+func (le *LogicalExpression) expressionNode()      {}
+func (le *LogicalExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LogicalExpression) Pos() mtoken.Position {
+	return le.Left.Pos()
+}
+
+func (le *LogicalExpression) End() mtoken.Position {
+	if le.Right != nil {
+		return le.Right.End()
+	}
+
+	return le.Token.End
+}
+
+func (le *LogicalExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(le.Left.String())
+	out.WriteString(" " + le.Operator + " ")
+	out.WriteString(le.Right.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// ParenExpression は (a + b) のような括弧でくくった式. 括弧の位置を範囲に含めるために残している
+// String() は括弧を付けない (中の式の String() が既に括弧でくくっている)
+type ParenExpression struct {
+	Token      mtoken.Token // '(' トークン
+	Expression Expression
+	Rparen     mtoken.Position // 「)」の位置
+}
+
+func (pe *ParenExpression) expressionNode()      {}
+func (pe *ParenExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *ParenExpression) Pos() mtoken.Position {
+	return pe.Token.Pos
+}
+
+func (pe *ParenExpression) End() mtoken.Position {
+	return after(pe.Rparen)
+}
+
+func (pe *ParenExpression) String() string { return pe.Expression.String() }
+
 type Boolean struct {
 	Token mtoken.Token
 	Value bool
@@ -183,17 +479,42 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
-func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) Pos() mtoken.Position {
+	return b.Token.Pos
+}
+
+func (b *Boolean) End() mtoken.Position {
+	return b.Token.End
+}
+
+func (b *Boolean) String() string { return b.Token.Literal }
 
 type IfExpression struct {
 	Token       mtoken.Token // 'if' トークン
 	Condition   Expression
 	Consequence *BlockStatement
+	ElseIfs     []*ElseIf // else if 節. 書かれた順に並ぶ
 	Alternative *BlockStatement
 }
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() mtoken.Position {
+	return ie.Token.Pos
+}
+
+func (ie *IfExpression) End() mtoken.Position {
+	if ie.Alternative != nil {
+		return ie.Alternative.End()
+	}
+
+	if len(ie.ElseIfs) > 0 {
+		return ie.ElseIfs[len(ie.ElseIfs)-1].End()
+	}
+
+	return ie.Consequence.End()
+}
+
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -202,6 +523,10 @@ func (ie *IfExpression) String() string {
 	out.WriteString(" ")
 	out.WriteString(ie.Consequence.String())
 
+	for _, ei := range ie.ElseIfs {
+		out.WriteString(ei.String())
+	}
+
 	if ie.Alternative != nil {
 		out.WriteString("else ")
 		out.WriteString(ie.Alternative.String())
@@ -210,13 +535,58 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ElseIf は if 式の else if (条件) { ... } 節
+type ElseIf struct {
+	Token       mtoken.Token // else の後ろの 'if' トークン
+	Condition   Expression
+	Consequence *BlockStatement
+}
+
+func (ei *ElseIf) TokenLiteral() string { return ei.Token.Literal }
+func (ei *ElseIf) Pos() mtoken.Position {
+	return ei.Token.Pos
+}
+
+func (ei *ElseIf) End() mtoken.Position {
+	return ei.Consequence.End()
+}
+
+func (ei *ElseIf) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("else if")
+	out.WriteString(ei.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ei.Consequence.String())
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      mtoken.Token // トークン
 	Statements []Statement
+	Rbrace     mtoken.Position // 「}」の位置
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() mtoken.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BlockStatement) End() mtoken.Position {
+	if bs.Rbrace.IsValid() {
+		return after(bs.Rbrace)
+	}
+
+	// 閉じ括弧がないまま入力が終わった
+	if len(bs.Statements) > 0 {
+		return bs.Statements[len(bs.Statements)-1].End()
+	}
+
+	return bs.Token.End
+}
+
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -226,3 +596,304 @@ func (bs *BlockStatement) String() string {
 
 	return out.String()
 }
+
+type FunctionLiteral struct {
+	Token      mtoken.Token // 'fn' トークン
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (fl *FunctionLiteral) expressionNode()      {}
+func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() mtoken.Position {
+	return fl.Token.Pos
+}
+
+func (fl *FunctionLiteral) End() mtoken.Position {
+	if fl.Body != nil {
+		return fl.Body.End()
+	}
+
+	return fl.Token.End
+}
+
+func (fl *FunctionLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range fl.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fl.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {")
+
+	if body := fl.Body.String(); body != "" {
+		out.WriteString(" " + body + " ")
+	}
+
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type CallExpression struct {
+	Token     mtoken.Token // '(' トークン
+	Function  Expression   // 呼び出す関数. f や fn() {} のほか f(1)、a[0]、h.f など任意の式
+	Arguments []Expression
+	Rparen    mtoken.Position // 「)」の位置
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() mtoken.Position {
+	return ce.Function.Pos()
+}
+
+func (ce *CallExpression) End() mtoken.Position {
+	return after(ce.Rparen)
+}
+
+func (ce *CallExpression) String() string {
+	var out bytes.Buffer
+
+	args := []string{}
+	for _, a := range ce.Arguments {
+		args = append(args, a.String())
+	}
+
+	out.WriteString(ce.Function.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(args, ", "))
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type ArrayLiteral struct {
+	Token    mtoken.Token // '[' トークン
+	Elements []Expression
+	Rbracket mtoken.Position // 「]」の位置
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() mtoken.Position {
+	return al.Token.Pos
+}
+
+func (al *ArrayLiteral) End() mtoken.Position {
+	return after(al.Rbracket)
+}
+
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token    mtoken.Token // '[' トークン
+	Left     Expression
+	Index    Expression
+	Rbracket mtoken.Position // 「]」の位置
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() mtoken.Position {
+	return ie.Left.Pos()
+}
+
+func (ie *IndexExpression) End() mtoken.Position {
+	return after(ie.Rbracket)
+}
+
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// FieldExpression は h.name のようなフィールドアクセス
+type FieldExpression struct {
+	Token mtoken.Token // '.' トークン
+	Left  Expression
+	Field *Identifier
+}
+
+func (fe *FieldExpression) expressionNode()      {}
+func (fe *FieldExpression) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FieldExpression) Pos() mtoken.Position {
+	return fe.Left.Pos()
+}
+
+func (fe *FieldExpression) End() mtoken.Position {
+	return fe.Field.End()
+}
+
+func (fe *FieldExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(fe.Left.String())
+	out.WriteString(".")
+	out.WriteString(fe.Field.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// HashPair はハッシュリテラルのキーと値の組
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+type HashLiteral struct {
+	Token  mtoken.Token    // '{' トークン
+	Pairs  []HashPair      // ソースに書かれた順
+	Rbrace mtoken.Position // 「}」の位置
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() mtoken.Position {
+	return hl.Token.Pos
+}
+
+func (hl *HashLiteral) End() mtoken.Position {
+	return after(hl.Rbrace)
+}
+
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type WhileStatement struct {
+	Token     mtoken.Token // 'while' トークン
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() mtoken.Position {
+	return ws.Token.Pos
+}
+
+func (ws *WhileStatement) End() mtoken.Position {
+	return ws.Body.End()
+}
+
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(" ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement は for (x in xs) { ... } . Iterable の要素を順に Variable に束縛して Body を実行する
+type ForStatement struct {
+	Token    mtoken.Token // 'for' トークン
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() mtoken.Position {
+	return fs.Token.Pos
+}
+
+func (fs *ForStatement) End() mtoken.Position {
+	return fs.Body.End()
+}
+
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for")
+	out.WriteString("(" + fs.Variable.String() + " in " + fs.Iterable.String() + ")")
+	out.WriteString(" ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token mtoken.Token // 'break' トークン
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() mtoken.Position {
+	return bs.Token.Pos
+}
+
+func (bs *BreakStatement) End() mtoken.Position {
+	return bs.Token.End
+}
+
+func (bs *BreakStatement) String() string { return bs.TokenLiteral() + ";" }
+
+type ContinueStatement struct {
+	Token mtoken.Token // 'continue' トークン
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() mtoken.Position {
+	return cs.Token.Pos
+}
+
+func (cs *ContinueStatement) End() mtoken.Position {
+	return cs.Token.End
+}
+
+func (cs *ContinueStatement) String() string { return cs.TokenLiteral() + ";" }
+
+// after は1バイトの区切り記号 (「}」など) の位置から、その直後の位置を返す
+func after(delim mtoken.Position) mtoken.Position {
+	if !delim.IsValid() {
+		return delim
+	}
+
+	delim.Offset++
+	delim.Column++
+
+	return delim
+}
@@ -0,0 +1,477 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+/*
+JSON 形式
+
+ノードは JSON のオブジェクトで、最初のキー "kind" にノードの型名が入る
+残りのキーは構造体のフィールド名の先頭を小文字にしたもので、フィールドの宣言順に並ぶ
+フィールド名を変えると形式も変わるので、キーは json_test.go の TestJSONKeys で固定している
+
+	{"kind": "Identifier", "token": Token, "value": "x"}
+
+フィールドの値は次のように書く
+
+	Token        {"type": "IDENT", "literal": "x", "pos": Position, "end": Position, "comments": [Comment, ...]}
+	             comments はコメントがあるときだけ
+	Comment      {"text": "// comment", "pos": Position}
+	Position     {"filename": "main.mk", "offset": 0, "line": 1, "column": 1}
+	             filename は空なら省く. 位置がないときは offset, line, column が 0
+	ノード       ノードのオブジェクト. nil なら null だが、省けない子が nil の木は書き出せずエラーになる
+	ノードの並び ノードのオブジェクトの配列. nil なら null
+	HashPair     {"key": ノード, "value": ノード}
+	その他       文字列、数値、真偽値. 整数は int64 の範囲の整数
+
+ノードの種類とキー (kind と token は省略)
+
+	Program             statements
+	LetStatement        name, value
+	AssignStatement     target, operator, value
+	ReturnStatement     returnValue
+	ExpressionStatement expression
+	BlockStatement      statements, rbrace
+	WhileStatement      condition, body
+	ForStatement        variable, iterable, body
+	BreakStatement
+	ContinueStatement
+	BadStatement
+	BadExpression
+	Identifier          value
+	IntegerLiteral      value
+	FloatLiteral        value
+	StringLiteral       value
+	Boolean             value
+	PrefixExpression    operator, right
+	InfixExpression     left, operator, right
+	LogicalExpression   left, operator, right
+	ParenExpression     expression, rparen
+	IfExpression        condition, consequence, elseIfs, alternative
+	ElseIf              condition, consequence
+	FunctionLiteral     parameters, body
+	CallExpression      function, arguments, rparen
+	ArrayLiteral        elements, rbracket
+	IndexExpression     left, index, rbracket
+	FieldExpression     left, field
+	HashLiteral         pairs, rbrace
+
+Program にはトークンがないので token もない
+読み込むときは知らないキーを無視し、ないキーはゼロ値にする
+ただし子のノードは ReturnStatement の returnValue と IfExpression の alternative のほかは省けず、
+null にもできない. ノードの並びの要素も null にできない
+*/
+
+// nodeKinds は "kind" の値とノードの型の対応. ノードの種類を増やしたらここにも追加すること
+var nodeKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{},
+		&LetStatement{},
+		&AssignStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{},
+		&BlockStatement{},
+		&WhileStatement{},
+		&ForStatement{},
+		&BreakStatement{},
+		&ContinueStatement{},
+		&BadStatement{},
+		&BadExpression{},
+		&Identifier{},
+		&IntegerLiteral{},
+		&FloatLiteral{},
+		&StringLiteral{},
+		&Boolean{},
+		&PrefixExpression{},
+		&InfixExpression{},
+		&LogicalExpression{},
+		&ParenExpression{},
+		&IfExpression{},
+		&ElseIf{},
+		&FunctionLiteral{},
+		&CallExpression{},
+		&ArrayLiteral{},
+		&IndexExpression{},
+		&FieldExpression{},
+		&HashLiteral{},
+	} {
+		typ := reflect.TypeOf(node).Elem()
+		nodeKinds[typ.Name()] = typ
+	}
+}
+
+// optionalFields は null にできる子のノード. 「型名.フィールド名」で書く
+var optionalFields = map[string]bool{
+	"ReturnStatement.ReturnValue": true,
+	"IfExpression.Alternative":    true,
+}
+
+var (
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+	tokenType    = reflect.TypeOf(mtoken.Token{})
+	positionType = reflect.TypeOf(mtoken.Position{})
+)
+
+type jsonToken struct {
+	Type     string        `json:"type"`
+	Literal  string        `json:"literal"`
+	Pos      jsonPosition  `json:"pos"`
+	End      jsonPosition  `json:"end"`
+	Comments []jsonComment `json:"comments,omitempty"`
+}
+
+type jsonComment struct {
+	Text string       `json:"text"`
+	Pos  jsonPosition `json:"pos"`
+}
+
+type jsonPosition struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+func toJSONPosition(pos mtoken.Position) jsonPosition {
+	return jsonPosition{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
+
+func (pos jsonPosition) position() mtoken.Position {
+	return mtoken.Position{Filename: pos.Filename, Offset: pos.Offset, Line: pos.Line, Column: pos.Column}
+}
+
+func toJSONToken(tok mtoken.Token) jsonToken {
+	jt := jsonToken{
+		Type:    string(tok.Type),
+		Literal: tok.Literal,
+		Pos:     toJSONPosition(tok.Pos),
+		End:     toJSONPosition(tok.End),
+	}
+
+	for _, c := range tok.Comments {
+		jt.Comments = append(jt.Comments, jsonComment{Text: c.Text, Pos: toJSONPosition(c.Pos)})
+	}
+
+	return jt
+}
+
+func (jt jsonToken) token() mtoken.Token {
+	tok := mtoken.Token{
+		Type:    mtoken.TokenType(jt.Type),
+		Literal: jt.Literal,
+		Pos:     jt.Pos.position(),
+		End:     jt.End.position(),
+	}
+
+	for _, c := range jt.Comments {
+		tok.Comments = append(tok.Comments, mtoken.Comment{Text: c.Text, Pos: c.Pos.position()})
+	}
+
+	return tok
+}
+
+// jsonKey はフィールド名の先頭を小文字にした JSON のキーを返す
+func jsonKey(field string) string {
+	r, size := utf8.DecodeRuneInString(field)
+	return string(unicode.ToLower(r)) + field[size:]
+}
+
+// MarshalJSON は program を JSON に変換する. 形式はこのファイルの先頭のコメントを参照
+func MarshalJSON(program *Program) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeNode(&buf, program); err != nil {
+		return nil, fmt.Errorf("ast: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON は MarshalJSON が出力した JSON から Program を組み立てる
+func UnmarshalJSON(data []byte) (*Program, error) {
+	node, err := decodeNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("ast: %v", err)
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected a Program, got %s", kindOf(node))
+	}
+
+	return program, nil
+}
+
+func kindOf(node Node) string {
+	if node == nil {
+		return "null"
+	}
+
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+func encodeNode(buf *bytes.Buffer, node Node) error {
+	if node == nil {
+		buf.WriteString("null")
+		return nil
+	}
+
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("cannot encode node of type %T", node)
+	}
+
+	if v.IsNil() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	kind := kindOf(node)
+	if _, ok := nodeKinds[kind]; !ok {
+		return fmt.Errorf("cannot encode node of type %T", node)
+	}
+
+	buf.WriteString(`{"kind":`)
+	if err := writeJSON(buf, kind); err != nil {
+		return err
+	}
+
+	return encodeFields(buf, v.Elem(), true)
+}
+
+// encodeFields は構造体のフィールドを「"key":value」の並びで書き、オブジェクトを閉じる
+// comma が true なら最初のフィールドの前にも「,」を書く
+// 読み込むときに省けない子のノードが nil ならエラーにする
+func encodeFields(buf *bytes.Buffer, v reflect.Value, comma bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		if i > 0 || comma {
+			buf.WriteByte(',')
+		}
+
+		if err := writeJSON(buf, jsonKey(field.Name)); err != nil {
+			return err
+		}
+
+		buf.WriteByte(':')
+
+		if field.Type.Implements(nodeType) && isNilValue(v.Field(i)) {
+			if !optionalFields[v.Type().Name()+"."+field.Name] {
+				return fmt.Errorf("%s.%s: node is required", v.Type().Name(), jsonKey(field.Name))
+			}
+
+			buf.WriteString("null")
+			continue
+		}
+
+		if err := encodeValue(buf, v.Field(i)); err != nil {
+			return fmt.Errorf("%s.%s: %v", v.Type().Name(), jsonKey(field.Name), err)
+		}
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	switch {
+	case v.Type() == tokenType:
+		return writeJSON(buf, toJSONToken(v.Interface().(mtoken.Token)))
+
+	case v.Type() == positionType:
+		return writeJSON(buf, toJSONPosition(v.Interface().(mtoken.Position)))
+
+	case v.Type().Implements(nodeType):
+		// null にできる子は encodeFields が扱うので、ここに来るのはノードの並びの要素
+		if isNilValue(v) {
+			return fmt.Errorf("node is required")
+		}
+
+		return encodeNode(buf, v.Interface().(Node))
+
+	case v.Kind() == reflect.Slice:
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+		buf.WriteByte(']')
+
+		return nil
+
+	case v.Kind() == reflect.Struct:
+		// HashPair のようなノードでない構造体は kind のないオブジェクトにする
+		buf.WriteByte('{')
+		return encodeFields(buf, v, false)
+	}
+
+	return writeJSON(buf, v.Interface())
+}
+
+// isNilValue は v が nil か、nil のポインタを入れたインタフェースかどうかを返す
+func isNilValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return true
+		}
+
+		v = v.Elem()
+	}
+
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	buf.Write(data)
+
+	return nil
+}
+
+func isNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
+
+func decodeNode(data []byte) (Node, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	if raw, ok := fields["kind"]; !ok || json.Unmarshal(raw, &kind) != nil {
+		return nil, fmt.Errorf("node has no kind")
+	}
+
+	typ, ok := nodeKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %q", kind)
+	}
+
+	v := reflect.New(typ)
+	if err := decodeFields(v.Elem(), fields); err != nil {
+		return nil, err
+	}
+
+	return v.Interface().(Node), nil
+}
+
+func decodeFields(v reflect.Value, fields map[string]json.RawMessage) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		raw, ok := fields[jsonKey(field.Name)]
+		if !ok || isNull(raw) {
+			if field.Type.Implements(nodeType) && !optionalFields[v.Type().Name()+"."+field.Name] {
+				return fmt.Errorf("%s.%s: node is required", v.Type().Name(), jsonKey(field.Name))
+			}
+
+			continue
+		}
+
+		if err := decodeValue(v.Field(i), raw); err != nil {
+			return fmt.Errorf("%s.%s: %v", v.Type().Name(), jsonKey(field.Name), err)
+		}
+	}
+
+	return nil
+}
+
+func decodeValue(v reflect.Value, raw json.RawMessage) error {
+	switch {
+	case v.Type() == tokenType:
+		var jt jsonToken
+		if err := json.Unmarshal(raw, &jt); err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(jt.token()))
+
+	case v.Type() == positionType:
+		var pos jsonPosition
+		if err := json.Unmarshal(raw, &pos); err != nil {
+			return err
+		}
+
+		v.Set(reflect.ValueOf(pos.position()))
+
+	case v.Type().Implements(nodeType):
+		node, err := decodeNode(raw)
+		if err != nil {
+			return err
+		}
+
+		// null の子は decodeFields が扱うので、ここに来るのはノードの並びの要素
+		if node == nil {
+			return fmt.Errorf("node is required")
+		}
+
+		nv := reflect.ValueOf(node)
+		if !nv.Type().AssignableTo(v.Type()) {
+			return fmt.Errorf("%s cannot be used as %s", kindOf(node), v.Type())
+		}
+
+		v.Set(nv)
+
+	case v.Kind() == reflect.Slice:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return err
+		}
+
+		if elems == nil {
+			return nil
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+		for i, elem := range elems {
+			if err := decodeValue(slice.Index(i), elem); err != nil {
+				return fmt.Errorf("[%d]: %v", i, err)
+			}
+		}
+
+		v.Set(slice)
+
+	case v.Kind() == reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return err
+		}
+
+		return decodeFields(v, fields)
+
+	default:
+		return json.Unmarshal(raw, v.Addr().Interface())
+	}
+
+	return nil
+}
@@ -0,0 +1,324 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+func TestJSONKindsCoverAllNodeTypes(t *testing.T) {
+	var kinds []string
+	for kind := range nodeKinds {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	names := nodeTypeNames(t)
+	if !reflect.DeepEqual(kinds, names) {
+		t.Errorf("nodeKinds does not match the node types.\nkinds=%v\ntypes=%v", kinds, names)
+	}
+}
+
+func TestJSONRoundTripAllNodeTypes(t *testing.T) {
+	for name, sample := range walkSamples() {
+		var buf bytes.Buffer
+		if err := encodeNode(&buf, sample); err != nil {
+			t.Fatalf("encodeNode(%s) returned error: %v", name, err)
+		}
+
+		if !strings.HasPrefix(buf.String(), `{"kind":"`+name+`"`) {
+			t.Errorf("%s: JSON does not start with its kind. got=%s", name, buf.String())
+		}
+
+		decoded, err := decodeNode(buf.Bytes())
+		if err != nil {
+			t.Fatalf("decodeNode(%s) returned error: %v\n%s", name, err, buf.String())
+		}
+
+		if !reflect.DeepEqual(decoded, sample) {
+			t.Errorf("%s changed after round trip.\nwant=%#v\ngot= %#v", name, sample, decoded)
+		}
+	}
+}
+
+// 形式の変更に気付けるよう、全てのノードの種類についてキーとその順番を固定する
+// 構造体のフィールド名を変えるとキーも変わってしまうので、このテストが失敗したら形式を変えてよいか確かめること
+func TestJSONKeys(t *testing.T) {
+	expected := map[string]string{
+		"Program":             "kind statements",
+		"LetStatement":        "kind token name value",
+		"AssignStatement":     "kind token target operator value",
+		"ReturnStatement":     "kind token returnValue",
+		"ExpressionStatement": "kind token expression",
+		"BlockStatement":      "kind token statements rbrace",
+		"WhileStatement":      "kind token condition body",
+		"ForStatement":        "kind token variable iterable body",
+		"BreakStatement":      "kind token",
+		"ContinueStatement":   "kind token",
+		"BadStatement":        "kind token",
+		"BadExpression":       "kind token",
+		"Identifier":          "kind token value",
+		"IntegerLiteral":      "kind token value",
+		"FloatLiteral":        "kind token value",
+		"StringLiteral":       "kind token value",
+		"Boolean":             "kind token value",
+		"PrefixExpression":    "kind token operator right",
+		"InfixExpression":     "kind token left operator right",
+		"LogicalExpression":   "kind token left operator right",
+		"ParenExpression":     "kind token expression rparen",
+		"IfExpression":        "kind token condition consequence elseIfs alternative",
+		"ElseIf":              "kind token condition consequence",
+		"FunctionLiteral":     "kind token parameters body",
+		"CallExpression":      "kind token function arguments rparen",
+		"ArrayLiteral":        "kind token elements rbracket",
+		"IndexExpression":     "kind token left index rbracket",
+		"FieldExpression":     "kind token left field",
+		"HashLiteral":         "kind token pairs rbrace",
+		"HashPair":            "key value",
+	}
+
+	samples := walkSamples()
+	for kind := range nodeKinds {
+		var buf bytes.Buffer
+		if err := encodeNode(&buf, samples[kind]); err != nil {
+			t.Fatalf("encodeNode(%s) returned error: %v", kind, err)
+		}
+
+		checkJSONKeys(t, kind, buf.Bytes(), expected[kind])
+
+		if kind == "HashLiteral" {
+			pairs := buf.Bytes()[bytes.Index(buf.Bytes(), []byte(`"pairs":[`))+len(`"pairs":[`):]
+			checkJSONKeys(t, "HashPair", pairs, expected["HashPair"])
+		}
+	}
+}
+
+// checkJSONKeys は data の先頭のオブジェクトのキーを順に並べたものが expected と同じか調べる
+func checkJSONKeys(t *testing.T, kind string, data []byte, expected string) {
+	t.Helper()
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		t.Fatalf("%s: %v", kind, err)
+	}
+
+	var keys []string
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+
+		keys = append(keys, key.(string))
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+	}
+
+	if got := strings.Join(keys, " "); got != expected {
+		t.Errorf("%s: wrong keys. expected=%q, got=%q", kind, expected, got)
+	}
+}
+
+// let x = 1; // one
+func jsonSampleProgram() *Program {
+	pos := func(offset int) mtoken.Position {
+		return mtoken.Position{Filename: "a.mk", Offset: offset, Line: 1, Column: offset + 1}
+	}
+
+	return &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: mtoken.Token{Type: mtoken.LET, Literal: "let", Pos: pos(0), End: pos(3)},
+				Name: &Identifier{
+					Token: mtoken.Token{Type: mtoken.IDENT, Literal: "x", Pos: pos(4), End: pos(5)},
+					Value: "x",
+				},
+				Value: &IntegerLiteral{
+					Token: mtoken.Token{
+						Type: mtoken.INT, Literal: "1", Pos: pos(8), End: pos(9),
+						Comments: []mtoken.Comment{{Text: "/* one */", Pos: pos(10)}},
+					},
+					Value: 1,
+				},
+			},
+		},
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	data, err := MarshalJSON(jsonSampleProgram())
+	if err != nil {
+		t.Fatalf("MarshalJSON returned error: %v", err)
+	}
+
+	expected := `{"kind":"Program","statements":[` +
+		`{"kind":"LetStatement",` +
+		`"token":{"type":"LET","literal":"let",` +
+		`"pos":{"filename":"a.mk","offset":0,"line":1,"column":1},` +
+		`"end":{"filename":"a.mk","offset":3,"line":1,"column":4}},` +
+		`"name":{"kind":"Identifier",` +
+		`"token":{"type":"IDENT","literal":"x",` +
+		`"pos":{"filename":"a.mk","offset":4,"line":1,"column":5},` +
+		`"end":{"filename":"a.mk","offset":5,"line":1,"column":6}},` +
+		`"value":"x"},` +
+		`"value":{"kind":"IntegerLiteral",` +
+		`"token":{"type":"INT","literal":"1",` +
+		`"pos":{"filename":"a.mk","offset":8,"line":1,"column":9},` +
+		`"end":{"filename":"a.mk","offset":9,"line":1,"column":10},` +
+		`"comments":[{"text":"/* one */","pos":{"filename":"a.mk","offset":10,"line":1,"column":11}}]},` +
+		`"value":1}}]}`
+
+	if string(data) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=     %s", expected, data)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	program := jsonSampleProgram()
+
+	data, err := MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON returned error: %v", err)
+	}
+
+	decoded, err := UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("program changed after round trip.\nwant=%#v\ngot= %#v", program, decoded)
+	}
+
+	if decoded.String() != "let x = 1;" {
+		t.Errorf("decoded.String() wrong. got=%q", decoded.String())
+	}
+}
+
+func TestUnmarshalJSONLenient(t *testing.T) {
+	// 知らないキーは無視し、ないキーはゼロ値にする. 省ける子のノードは nil になる
+	data := `{"kind":"Program","version":2,"statements":[` +
+		`{"kind":"ReturnStatement"},` +
+		`{"kind":"ReturnStatement","returnValue":null},` +
+		`{"kind":"ExpressionStatement","expression":{"kind":"IfExpression",` +
+		`"condition":{"kind":"Boolean","value":true,"extra":null},"consequence":{"kind":"BlockStatement"}}}]}`
+
+	program, err := UnmarshalJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("UnmarshalJSON returned error: %v", err)
+	}
+
+	expected := &Program{Statements: []Statement{
+		&ReturnStatement{},
+		&ReturnStatement{},
+		&ExpressionStatement{Expression: &IfExpression{Condition: &Boolean{Value: true}, Consequence: &BlockStatement{}}},
+	}}
+
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("wrong program.\nwant=%#v\ngot= %#v", expected, program)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Identifier","value":"x"}`, "ast: expected a Program, got Identifier"},
+		{`null`, "ast: expected a Program, got null"},
+		{`{"statements":[]}`, "ast: node has no kind"},
+		{`{"kind":"Program","statements":[{"kind":"GotoStatement"}]}`,
+			`ast: Program.statements: [0]: unknown node kind "GotoStatement"`},
+		{`{"kind":"Program","statements":[{"kind":"Identifier","value":"x"}]}`,
+			"ast: Program.statements: [0]: Identifier cannot be used as ast.Statement"},
+		{`{"kind":"Program","statements":[{"kind":"LetStatement","name":{"kind":"IntegerLiteral","value":1}}]}`,
+			"ast: Program.statements: [0]: LetStatement.name: IntegerLiteral cannot be used as *ast.Identifier"},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":{"kind":"IntegerLiteral","value":"1"}}]}`,
+			"ast: Program.statements: [0]: ExpressionStatement.expression: IntegerLiteral.value: " +
+				"json: cannot unmarshal string into Go value of type int64"},
+		{`[`, "ast: unexpected end of JSON input"},
+		{`{"kind":"Program","statements":[null]}`, "ast: Program.statements: [0]: node is required"},
+		{`{"kind":"Program","statements":[{"kind":"LetStatement"}]}`,
+			"ast: Program.statements: [0]: LetStatement.name: node is required"},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":null}]}`,
+			"ast: Program.statements: [0]: ExpressionStatement.expression: node is required"},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":{"kind":"IfExpression",` +
+			`"condition":{"kind":"Boolean"}}}]}`,
+			"ast: Program.statements: [0]: ExpressionStatement.expression: IfExpression.consequence: node is required"},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":{"kind":"CallExpression",` +
+			`"function":{"kind":"Identifier"},"arguments":[{"kind":"Identifier"},null]}}]}`,
+			"ast: Program.statements: [0]: ExpressionStatement.expression: CallExpression.arguments: [1]: node is required"},
+		{`{"kind":"Program","statements":[{"kind":"ExpressionStatement","expression":{"kind":"HashLiteral",` +
+			`"pairs":[{"key":{"kind":"Identifier"}}]}}]}`,
+			"ast: Program.statements: [0]: ExpressionStatement.expression: HashLiteral.pairs: [0]: HashPair.value: node is required"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalJSON([]byte(tt.input))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%s: wrong error.\nexpected=%q\ngot=     %q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestMarshalJSONErrors(t *testing.T) {
+	// UnmarshalJSON が読めない JSON は書き出さない
+	tests := []struct {
+		program  *Program
+		expected string
+	}{
+		{&Program{Statements: []Statement{exprStmt(&unknownExpression{})}},
+			"ast: Program.statements: [0]: ExpressionStatement.expression: cannot encode node of type *ast.unknownExpression"},
+		{&Program{Statements: []Statement{exprStmt(valueExpression{})}},
+			"ast: Program.statements: [0]: ExpressionStatement.expression: cannot encode node of type ast.valueExpression"},
+		{&Program{Statements: []Statement{exprStmt(nil)}},
+			"ast: Program.statements: [0]: ExpressionStatement.expression: node is required"},
+		{&Program{Statements: []Statement{exprStmt(ident("x")), (*LetStatement)(nil)}},
+			"ast: Program.statements: [1]: node is required"},
+		{&Program{Statements: []Statement{&LetStatement{Name: ident("x"), Value: (*Identifier)(nil)}}},
+			"ast: Program.statements: [0]: LetStatement.value: node is required"},
+		{&Program{Statements: []Statement{exprStmt(&HashLiteral{Pairs: []HashPair{{Key: ident("k")}}})}},
+			"ast: Program.statements: [0]: ExpressionStatement.expression: HashLiteral.pairs: [0]: HashPair.value: node is required"},
+	}
+
+	for _, tt := range tests {
+		_, err := MarshalJSON(tt.program)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.expected)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error.\nexpected=%q\ngot=     %q", tt.expected, err.Error())
+		}
+	}
+
+	// 省ける子は nil のまま書き出せる
+	program := &Program{Statements: []Statement{&ReturnStatement{}, exprStmt(&IfExpression{Condition: ident("x"), Consequence: block()})}}
+	if _, err := MarshalJSON(program); err != nil {
+		t.Errorf("MarshalJSON returned error: %v", err)
+	}
+}
+
+type unknownExpression struct{ unknownNode }
+
+func (*unknownExpression) expressionNode() {}
+
+// valueExpression はポインタでない Expression
+type valueExpression struct{ unknownNode }
+
+func (valueExpression) expressionNode() {}
@@ -0,0 +1,276 @@
+package ast
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ModifierFunc はノードを受け取り、そのノードの代わりに木に置くノードを返す
+type ModifierFunc func(Node) Node
+
+/*
+Modify は木を帰りがけ順に辿り、子を modifier で置き換えてから node 自身に modifier を適用した結果を返す
+子の置き換えは node をその場で書き換えるので、modifier がそのまま返したノードはトークンと位置を保つ
+nil の子には modifier を適用しない
+
+名前を宣言する識別子 (LetStatement.Name, ForStatement.Variable, FunctionLiteral.Parameters)、
+代入先の変数名 (x = 1 の x. 括弧でくくった (x) も含む) と FieldExpression.Field は値を表す式ではないので
+modifier に渡さない. 識別子を定数に置き換えても宣言や代入は壊れない
+a[i] = 1 や h.f = 1 の代入先は式として辿るので、a や i は置き換えられる
+
+modifier は元のノードと同じ場所に置けるノードを返すこと
+(文の位置には Statement、式の位置には Expression、ブロックの位置には *BlockStatement など)
+Program と BlockStatement の文について nil を返すと、その文を取り除く
+それ以外の場所に置けないノードや nil を返すと panic する
+*/
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch n := node.(type) {
+	// 文
+	case *Program:
+		n.Statements = modifyStatements(n.Statements, modifier)
+
+	case *LetStatement:
+		if n.Value != nil {
+			n.Value = modifyExpression(n.Value, modifier)
+		}
+
+	case *AssignStatement:
+		if n.Target != nil && !isVariable(n.Target) {
+			n.Target = modifyExpression(n.Target, modifier)
+		}
+		if n.Value != nil {
+			n.Value = modifyExpression(n.Value, modifier)
+		}
+
+	case *ReturnStatement:
+		if n.ReturnValue != nil {
+			n.ReturnValue = modifyExpression(n.ReturnValue, modifier)
+		}
+
+	case *ExpressionStatement:
+		if n.Expression != nil {
+			n.Expression = modifyExpression(n.Expression, modifier)
+		}
+
+	case *BlockStatement:
+		n.Statements = modifyStatements(n.Statements, modifier)
+
+	case *WhileStatement:
+		if n.Condition != nil {
+			n.Condition = modifyExpression(n.Condition, modifier)
+		}
+		if n.Body != nil {
+			n.Body = modifyBlock(n.Body, modifier)
+		}
+
+	case *ForStatement:
+		if n.Iterable != nil {
+			n.Iterable = modifyExpression(n.Iterable, modifier)
+		}
+		if n.Body != nil {
+			n.Body = modifyBlock(n.Body, modifier)
+		}
+
+	case *BadStatement, *BreakStatement, *ContinueStatement:
+		// 子はない
+
+	// 式
+	case *BadExpression, *Identifier, *IntegerLiteral, *FloatLiteral, *StringLiteral, *Boolean:
+		// 子はない
+
+	case *PrefixExpression:
+		if n.Right != nil {
+			n.Right = modifyExpression(n.Right, modifier)
+		}
+
+	case *InfixExpression:
+		if n.Left != nil {
+			n.Left = modifyExpression(n.Left, modifier)
+		}
+		if n.Right != nil {
+			n.Right = modifyExpression(n.Right, modifier)
+		}
+
+	case *LogicalExpression:
+		if n.Left != nil {
+			n.Left = modifyExpression(n.Left, modifier)
+		}
+		if n.Right != nil {
+			n.Right = modifyExpression(n.Right, modifier)
+		}
+
+	case *ParenExpression:
+		if n.Expression != nil {
+			n.Expression = modifyExpression(n.Expression, modifier)
+		}
+
+	case *IfExpression:
+		if n.Condition != nil {
+			n.Condition = modifyExpression(n.Condition, modifier)
+		}
+		if n.Consequence != nil {
+			n.Consequence = modifyBlock(n.Consequence, modifier)
+		}
+		for i, elseIf := range n.ElseIfs {
+			n.ElseIfs[i] = modifyElseIf(elseIf, modifier)
+		}
+		if n.Alternative != nil {
+			n.Alternative = modifyBlock(n.Alternative, modifier)
+		}
+
+	case *ElseIf:
+		if n.Condition != nil {
+			n.Condition = modifyExpression(n.Condition, modifier)
+		}
+		if n.Consequence != nil {
+			n.Consequence = modifyBlock(n.Consequence, modifier)
+		}
+
+	case *FunctionLiteral:
+		if n.Body != nil {
+			n.Body = modifyBlock(n.Body, modifier)
+		}
+
+	case *CallExpression:
+		if n.Function != nil {
+			n.Function = modifyExpression(n.Function, modifier)
+		}
+		modifyExpressions(n.Arguments, modifier)
+
+	case *ArrayLiteral:
+		modifyExpressions(n.Elements, modifier)
+
+	case *IndexExpression:
+		if n.Left != nil {
+			n.Left = modifyExpression(n.Left, modifier)
+		}
+		if n.Index != nil {
+			n.Index = modifyExpression(n.Index, modifier)
+		}
+
+	case *FieldExpression:
+		if n.Left != nil {
+			n.Left = modifyExpression(n.Left, modifier)
+		}
+
+	case *HashLiteral:
+		for i, pair := range n.Pairs {
+			if pair.Key != nil {
+				n.Pairs[i].Key = modifyExpression(pair.Key, modifier)
+			}
+			if pair.Value != nil {
+				n.Pairs[i].Value = modifyExpression(pair.Value, modifier)
+			}
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Modify: unexpected node type %T", n))
+	}
+
+	return modifier(node)
+}
+
+// modifyStatements は list の文を置き換え、modifier が nil を返した文を取り除いた list を返す
+func modifyStatements(list []Statement, modifier ModifierFunc) []Statement {
+	if list == nil {
+		return nil
+	}
+
+	modified := list[:0]
+	for _, stmt := range list {
+		if s := modifyStatement(stmt, modifier); s != nil {
+			modified = append(modified, s)
+		}
+	}
+
+	return modified
+}
+
+func modifyExpressions(list []Expression, modifier ModifierFunc) {
+	for i, exp := range list {
+		list[i] = modifyExpression(exp, modifier)
+	}
+}
+
+func modifyStatement(stmt Statement, modifier ModifierFunc) Statement {
+	modified := Modify(stmt, modifier)
+	if isNil(modified) {
+		return nil
+	}
+
+	s, ok := modified.(Statement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: cannot replace statement %T with %T", stmt, modified))
+	}
+
+	return s
+}
+
+func modifyExpression(exp Expression, modifier ModifierFunc) Expression {
+	modified := Modify(exp, modifier)
+	if isNil(modified) {
+		panic(fmt.Sprintf("ast.Modify: cannot replace %T with nil", exp))
+	}
+
+	e, ok := modified.(Expression)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: cannot replace expression %T with %T", exp, modified))
+	}
+
+	return e
+}
+
+func modifyBlock(block *BlockStatement, modifier ModifierFunc) *BlockStatement {
+	modified := Modify(block, modifier)
+	if isNil(modified) {
+		panic(fmt.Sprintf("ast.Modify: cannot replace %T with nil", block))
+	}
+
+	b, ok := modified.(*BlockStatement)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: cannot replace *ast.BlockStatement with %T", modified))
+	}
+
+	return b
+}
+
+func modifyElseIf(elseIf *ElseIf, modifier ModifierFunc) *ElseIf {
+	modified := Modify(elseIf, modifier)
+	if isNil(modified) {
+		panic(fmt.Sprintf("ast.Modify: cannot replace %T with nil", elseIf))
+	}
+
+	ei, ok := modified.(*ElseIf)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: cannot replace *ast.ElseIf with %T", modified))
+	}
+
+	return ei
+}
+
+// isVariable は exp が代入先の変数名 (x や (x)) かどうかを返す
+func isVariable(exp Expression) bool {
+	for {
+		paren, ok := exp.(*ParenExpression)
+		if !ok || paren == nil {
+			break
+		}
+
+		exp = paren.Expression
+	}
+
+	_, ok := exp.(*Identifier)
+
+	return ok
+}
+
+// isNil は node が nil か、nil のポインタを入れたインタフェースかどうかを返す
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(node)
+
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,335 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return integer(1) }
+	two := func() Expression { return integer(2) }
+
+	turnOneIntoTwo := func(node Node) Node {
+		lit, ok := node.(*IntegerLiteral)
+		if !ok {
+			return node
+		}
+
+		if lit.Value != 1 {
+			return node
+		}
+
+		lit.Value = 2
+
+		return lit
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{exprStmt(one())}},
+			&Program{Statements: []Statement{exprStmt(two())}},
+		},
+		{
+			&InfixExpression{Left: one(), Operator: "+", Right: two()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&InfixExpression{Left: two(), Operator: "+", Right: one()},
+			&InfixExpression{Left: two(), Operator: "+", Right: two()},
+		},
+		{
+			&PrefixExpression{Operator: "-", Right: one()},
+			&PrefixExpression{Operator: "-", Right: two()},
+		},
+		{
+			&IndexExpression{Left: one(), Index: one()},
+			&IndexExpression{Left: two(), Index: two()},
+		},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: block(exprStmt(one())),
+				ElseIfs:     []*ElseIf{{Condition: one(), Consequence: block(exprStmt(one()))}},
+				Alternative: block(exprStmt(one())),
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: block(exprStmt(two())),
+				ElseIfs:     []*ElseIf{{Condition: two(), Consequence: block(exprStmt(two()))}},
+				Alternative: block(exprStmt(two())),
+			},
+		},
+		{
+			&ReturnStatement{ReturnValue: one()},
+			&ReturnStatement{ReturnValue: two()},
+		},
+		{
+			&LetStatement{Name: ident("x"), Value: one()},
+			&LetStatement{Name: ident("x"), Value: two()},
+		},
+		{
+			&AssignStatement{Target: &IndexExpression{Left: ident("a"), Index: one()}, Operator: "=", Value: one()},
+			&AssignStatement{Target: &IndexExpression{Left: ident("a"), Index: two()}, Operator: "=", Value: two()},
+		},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(exprStmt(one()))},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: block(exprStmt(two()))},
+		},
+		{
+			&ArrayLiteral{Elements: []Expression{one(), one()}},
+			&ArrayLiteral{Elements: []Expression{two(), two()}},
+		},
+		{
+			&HashLiteral{Pairs: []HashPair{{Key: one(), Value: one()}}},
+			&HashLiteral{Pairs: []HashPair{{Key: two(), Value: two()}}},
+		},
+		{
+			&WhileStatement{Condition: one(), Body: block(exprStmt(one()))},
+			&WhileStatement{Condition: two(), Body: block(exprStmt(two()))},
+		},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, turnOneIntoTwo)
+
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("not equal. got=%#v, want=%#v", modified, tt.expected)
+		}
+	}
+}
+
+func TestModifyReachesAllChildren(t *testing.T) {
+	for name, sample := range walkSamples() {
+		// 名前を宣言する識別子とフィールド名は modifier に渡さない
+		declared := map[Node]bool{}
+		Inspect(sample, func(n Node) bool {
+			switch n := n.(type) {
+			case *LetStatement:
+				declared[n.Name] = true
+			case *AssignStatement:
+				if isVariable(n.Target) {
+					declared[n.Target] = true
+				}
+			case *ForStatement:
+				declared[n.Variable] = true
+			case *FunctionLiteral:
+				for _, param := range n.Parameters {
+					declared[param] = true
+				}
+			case *FieldExpression:
+				declared[n.Field] = true
+			}
+
+			return true
+		})
+
+		walked := 0
+		Inspect(sample, func(n Node) bool {
+			if n != nil && !declared[n] {
+				walked++
+			}
+
+			return true
+		})
+
+		modified := 0
+		Modify(sample, func(n Node) Node {
+			modified++
+			return n
+		})
+
+		if modified != walked {
+			t.Errorf("Modify(%s) called modifier %d times, but Walk visited %d nodes", name, modified, walked)
+		}
+	}
+}
+
+func TestModifySubstitutesIdentifiers(t *testing.T) {
+	// let x = x + 1; fn(x) { x }; h.x
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("x"), Value: &InfixExpression{Left: ident("x"), Operator: "+", Right: integer(1)}},
+		exprStmt(&FunctionLiteral{Parameters: []*Identifier{ident("x")}, Body: block(exprStmt(ident("x")))}),
+		exprStmt(&FieldExpression{Left: ident("h"), Field: ident("x")}),
+	}}
+
+	Modify(program, func(n Node) Node {
+		if id, ok := n.(*Identifier); ok && id.Value == "x" {
+			return integer(5)
+		}
+
+		return n
+	})
+
+	// 宣言の x とフィールド名の x は残る
+	expected := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("x"), Value: &InfixExpression{Left: integer(5), Operator: "+", Right: integer(1)}},
+		exprStmt(&FunctionLiteral{Parameters: []*Identifier{ident("x")}, Body: block(exprStmt(integer(5)))}),
+		exprStmt(&FieldExpression{Left: ident("h"), Field: ident("x")}),
+	}}
+
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("wrong program.\nwant=%#v\ngot= %#v", expected, program)
+	}
+}
+
+func TestModifyKeepsAssignedVariables(t *testing.T) {
+	// x = x + 1; (x) += 2; a[x] = x; h.x = x
+	paren := &ParenExpression{Expression: ident("x")}
+	program := &Program{Statements: []Statement{
+		&AssignStatement{Target: ident("x"), Operator: "=", Value: &InfixExpression{Left: ident("x"), Operator: "+", Right: integer(1)}},
+		&AssignStatement{Target: paren, Operator: "+=", Value: integer(2)},
+		&AssignStatement{Target: &IndexExpression{Left: ident("a"), Index: ident("x")}, Operator: "=", Value: ident("x")},
+		&AssignStatement{Target: &FieldExpression{Left: ident("h"), Field: ident("x")}, Operator: "=", Value: ident("x")},
+	}}
+
+	Modify(program, func(n Node) Node {
+		if id, ok := n.(*Identifier); ok && (id.Value == "x" || id.Value == "a") {
+			return integer(5)
+		}
+
+		return n
+	})
+
+	// 代入先の x はそのまま. 添字とフィールドアクセスの中の式は置き換わる
+	expected := &Program{Statements: []Statement{
+		&AssignStatement{Target: ident("x"), Operator: "=", Value: &InfixExpression{Left: integer(5), Operator: "+", Right: integer(1)}},
+		&AssignStatement{Target: &ParenExpression{Expression: ident("x")}, Operator: "+=", Value: integer(2)},
+		&AssignStatement{Target: &IndexExpression{Left: integer(5), Index: integer(5)}, Operator: "=", Value: integer(5)},
+		&AssignStatement{Target: &FieldExpression{Left: ident("h"), Field: ident("x")}, Operator: "=", Value: integer(5)},
+	}}
+
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("wrong program.\nwant=%#v\ngot= %#v", expected, program)
+	}
+}
+
+func TestModifyRemovesStatements(t *testing.T) {
+	// 1; break; 2; { break; 3 }
+	program := &Program{Statements: []Statement{
+		exprStmt(integer(1)),
+		&BreakStatement{},
+		exprStmt(integer(2)),
+		block(&BreakStatement{}, exprStmt(integer(3))),
+	}}
+
+	Modify(program, func(n Node) Node {
+		if _, ok := n.(*BreakStatement); ok {
+			return nil
+		}
+
+		return n
+	})
+
+	expected := &Program{Statements: []Statement{
+		exprStmt(integer(1)),
+		exprStmt(integer(2)),
+		block(exprStmt(integer(3))),
+	}}
+
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("wrong program.\nwant=%#v\ngot= %#v", expected, program)
+	}
+}
+
+func TestModifyBottomUp(t *testing.T) {
+	// -(a + b)
+	program := &Program{Statements: []Statement{
+		exprStmt(&PrefixExpression{Operator: "-", Right: &InfixExpression{Left: ident("a"), Operator: "+", Right: ident("b")}}),
+	}}
+
+	var order []string
+	Modify(program, func(n Node) Node {
+		switch n := n.(type) {
+		case *Identifier:
+			order = append(order, n.Value)
+		case *InfixExpression:
+			order = append(order, n.Operator)
+		case *PrefixExpression:
+			order = append(order, "neg")
+		case *ExpressionStatement:
+			order = append(order, "stmt")
+		case *Program:
+			order = append(order, "program")
+		}
+
+		return n
+	})
+
+	expected := "a b + neg stmt program"
+	if got := strings.Join(order, " "); got != expected {
+		t.Errorf("wrong order. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestModifyPreservesTokens(t *testing.T) {
+	pos := func(col int) mtoken.Position { return mtoken.Position{Line: 1, Column: col, Offset: col - 1} }
+
+	// x + 1 の x を y に置き換える. + と 1 のトークンはそのまま残る
+	plus := mtoken.Token{Type: mtoken.PLUS, Literal: "+", Pos: pos(3)}
+	lit := &IntegerLiteral{Token: mtoken.Token{Type: mtoken.INT, Literal: "1", Pos: pos(5)}, Value: 1}
+	infix := &InfixExpression{
+		Token:    plus,
+		Left:     &Identifier{Token: mtoken.Token{Type: mtoken.IDENT, Literal: "x", Pos: pos(1)}, Value: "x"},
+		Operator: "+",
+		Right:    lit,
+	}
+
+	modified := Modify(infix, func(n Node) Node {
+		if id, ok := n.(*Identifier); ok && id.Value == "x" {
+			return &Identifier{Token: mtoken.Token{Type: mtoken.IDENT, Literal: "y", Pos: id.Token.Pos}, Value: "y"}
+		}
+
+		return n
+	})
+
+	if modified != infix {
+		t.Fatalf("Modify returned a different node: %T", modified)
+	}
+
+	if !reflect.DeepEqual(infix.Token, plus) {
+		t.Errorf("infix.Token changed. got=%+v", infix.Token)
+	}
+
+	if infix.Right != lit || lit.Token.Pos != pos(5) {
+		t.Errorf("unchanged child was replaced. got=%+v", infix.Right)
+	}
+
+	if infix.String() != "(y + 1)" {
+		t.Errorf("infix.String() wrong. got=%q", infix.String())
+	}
+}
+
+func TestModifyPanicsOnMisplacedNode(t *testing.T) {
+	tests := []struct {
+		replacement Node
+		expected    string
+	}{
+		{&BreakStatement{}, "ast.Modify: cannot replace expression *ast.IntegerLiteral with *ast.BreakStatement"},
+		{nil, "ast.Modify: cannot replace *ast.IntegerLiteral with nil"},
+	}
+
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if r := recover(); r != tt.expected {
+					t.Errorf("wrong panic. expected=%q, got=%v", tt.expected, r)
+				}
+			}()
+
+			Modify(exprStmt(integer(1)), func(n Node) Node {
+				if _, ok := n.(*IntegerLiteral); ok {
+					return tt.replacement
+				}
+
+				return n
+			})
+		}()
+	}
+}
@@ -0,0 +1,304 @@
+package ast
+
+import (
+	goast "go/ast"
+	goparser "go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: mtoken.Token{Type: mtoken.IDENT, Literal: name}, Value: name}
+}
+
+func integer(v int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: mtoken.Token{Type: mtoken.INT}, Value: v}
+}
+
+func block(stmts ...Statement) *BlockStatement {
+	return &BlockStatement{Token: mtoken.Token{Type: mtoken.LBRACE, Literal: "{"}, Statements: stmts}
+}
+
+func exprStmt(exp Expression) *ExpressionStatement {
+	return &ExpressionStatement{Expression: exp}
+}
+
+/*
+全てのノードの種類について、子を全て埋めた見本
+ノードの種類を増やしたら、ここと Walk の両方に追加すること
+*/
+func walkSamples() map[string]Node {
+	return map[string]Node{
+		"Program":             &Program{Statements: []Statement{exprStmt(ident("a")), exprStmt(ident("b"))}},
+		"LetStatement":        &LetStatement{Name: ident("x"), Value: integer(1)},
+		"AssignStatement":     &AssignStatement{Target: ident("x"), Operator: "+=", Value: integer(1)},
+		"BadStatement":        &BadStatement{},
+		"BadExpression":       &BadExpression{},
+		"Identifier":          ident("x"),
+		"ReturnStatement":     &ReturnStatement{ReturnValue: ident("x")},
+		"ExpressionStatement": exprStmt(ident("x")),
+		"IntegerLiteral":      integer(1),
+		"FloatLiteral":        &FloatLiteral{Value: 1.5},
+		"StringLiteral":       &StringLiteral{Value: "s"},
+		"PrefixExpression":    &PrefixExpression{Operator: "-", Right: ident("x")},
+		"InfixExpression":     &InfixExpression{Left: ident("x"), Operator: "+", Right: ident("y")},
+		"LogicalExpression":   &LogicalExpression{Left: ident("x"), Operator: "&&", Right: ident("y")},
+		"ParenExpression":     &ParenExpression{Expression: ident("x")},
+		"Boolean":             &Boolean{Value: true},
+		"IfExpression": &IfExpression{
+			Condition:   ident("a"),
+			Consequence: block(exprStmt(ident("b"))),
+			ElseIfs: []*ElseIf{
+				{Condition: ident("c"), Consequence: block(exprStmt(ident("d")))},
+				{Condition: ident("e"), Consequence: block(exprStmt(ident("f")))},
+			},
+			Alternative: block(exprStmt(ident("g"))),
+		},
+		"ElseIf":            &ElseIf{Condition: ident("a"), Consequence: block()},
+		"BlockStatement":    block(exprStmt(ident("a")), exprStmt(ident("b"))),
+		"FunctionLiteral":   &FunctionLiteral{Parameters: []*Identifier{ident("x"), ident("y")}, Body: block()},
+		"CallExpression":    &CallExpression{Function: ident("f"), Arguments: []Expression{ident("x"), ident("y")}},
+		"ArrayLiteral":      &ArrayLiteral{Elements: []Expression{integer(1), integer(2)}},
+		"IndexExpression":   &IndexExpression{Left: ident("a"), Index: integer(0)},
+		"FieldExpression":   &FieldExpression{Left: ident("h"), Field: ident("name")},
+		"HashLiteral":       &HashLiteral{Pairs: []HashPair{{Key: ident("k1"), Value: integer(1)}, {Key: ident("k2"), Value: integer(2)}}},
+		"WhileStatement":    &WhileStatement{Condition: ident("x"), Body: block()},
+		"ForStatement":      &ForStatement{Variable: ident("x"), Iterable: ident("xs"), Body: block()},
+		"BreakStatement":    &BreakStatement{},
+		"ContinueStatement": &ContinueStatement{},
+	}
+}
+
+// nodeTypeNames は ast パッケージのソースから TokenLiteral メソッドを持つ型の名前を集める
+func nodeTypeNames(t *testing.T) []string {
+	t.Helper()
+
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fset := token.NewFileSet()
+
+	var names []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+
+		file, err := goparser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatalf("could not parse %s: %v", path, err)
+		}
+
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+
+			recv := fn.Recv.List[0].Type
+			if star, ok := recv.(*goast.StarExpr); ok {
+				recv = star.X
+			}
+
+			names = append(names, recv.(*goast.Ident).Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// directChildren は node の子として Walk が訪れたノードを順に返す
+func directChildren(node Node) []Node {
+	var children []Node
+
+	depth := 0
+	Inspect(node, func(n Node) bool {
+		if n == nil {
+			depth--
+			return false
+		}
+
+		depth++
+		if depth == 2 {
+			children = append(children, n)
+		}
+
+		return true
+	})
+
+	return children
+}
+
+// fieldChildren はリフレクションで node のフィールドからノードを宣言順に集める
+func fieldChildren(node Node) []Node {
+	var children []Node
+
+	nodeType := reflect.TypeOf((*Node)(nil)).Elem()
+
+	var collect func(v reflect.Value)
+	collect = func(v reflect.Value) {
+		switch {
+		case v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr:
+			if !v.IsNil() && v.Type().Implements(nodeType) {
+				children = append(children, v.Interface().(Node))
+			}
+		case v.Kind() == reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				collect(v.Index(i))
+			}
+		case v.Kind() == reflect.Struct && v.Type() != reflect.TypeOf(mtoken.Token{}):
+			for i := 0; i < v.NumField(); i++ {
+				collect(v.Field(i))
+			}
+		}
+	}
+
+	collect(reflect.ValueOf(node).Elem())
+
+	return children
+}
+
+func TestWalkCoversAllNodeTypes(t *testing.T) {
+	samples := walkSamples()
+
+	for _, name := range nodeTypeNames(t) {
+		sample, ok := samples[name]
+		if !ok {
+			t.Errorf("no walk sample for node type %s. add it to walkSamples and Walk", name)
+			continue
+		}
+
+		if got := reflect.TypeOf(sample).Elem().Name(); got != name {
+			t.Errorf("walk sample for %s has type %s", name, got)
+			continue
+		}
+
+		expected := fieldChildren(sample)
+		got := directChildren(sample)
+
+		if len(got) != len(expected) {
+			t.Errorf("Walk(%s) visited %d children, want %d", name, len(got), len(expected))
+			continue
+		}
+
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("Walk(%s) child %d wrong. expected=%T %q, got=%T %q",
+					name, i, expected[i], expected[i], got[i], got[i])
+			}
+		}
+	}
+}
+
+func TestWalkSkipsNilChildren(t *testing.T) {
+	nodes := []Node{
+		&LetStatement{Name: ident("x")},
+		&ReturnStatement{},
+		&IfExpression{Condition: ident("x"), Consequence: block()},
+		&FunctionLiteral{},
+		&ExpressionStatement{},
+	}
+
+	for _, node := range nodes {
+		Inspect(node, func(Node) bool { return true })
+	}
+}
+
+func TestWalkPanicsOnUnknownNode(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Walk did not panic on an unknown node type")
+		}
+	}()
+
+	Inspect(unknownNode{}, func(Node) bool { return true })
+}
+
+type unknownNode struct{}
+
+func (unknownNode) TokenLiteral() string { return "" }
+func (unknownNode) String() string       { return "" }
+func (unknownNode) Pos() mtoken.Position { return mtoken.Position{} }
+func (unknownNode) End() mtoken.Position { return mtoken.Position{} }
+
+func TestInspectOrder(t *testing.T) {
+	// let x = if (a) { b } else if (c) { d } else { e }; f(g, [h], {i: j}).k
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("x"),
+				Value: &IfExpression{
+					Condition:   ident("a"),
+					Consequence: block(exprStmt(ident("b"))),
+					ElseIfs:     []*ElseIf{{Condition: ident("c"), Consequence: block(exprStmt(ident("d")))}},
+					Alternative: block(exprStmt(ident("e"))),
+				},
+			},
+			exprStmt(&FieldExpression{
+				Left: &CallExpression{
+					Function: ident("f"),
+					Arguments: []Expression{
+						ident("g"),
+						&ArrayLiteral{Elements: []Expression{ident("h")}},
+						&HashLiteral{Pairs: []HashPair{{Key: ident("i"), Value: ident("j")}}},
+					},
+				},
+				Field: ident("k"),
+			}),
+		},
+	}
+
+	var names []string
+	Inspect(program, func(n Node) bool {
+		if id, ok := n.(*Identifier); ok {
+			names = append(names, id.Value)
+		}
+
+		return true
+	})
+
+	expected := "x a b c d e f g h i j k"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("wrong visiting order. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestInspectPrune(t *testing.T) {
+	// fn(x) { y } の本体は辿らない
+	fn := &FunctionLiteral{Parameters: []*Identifier{ident("x")}, Body: block(exprStmt(ident("y")))}
+	program := &Program{Statements: []Statement{exprStmt(fn), exprStmt(ident("z"))}}
+
+	var names []string
+	nils := 0
+	Inspect(program, func(n Node) bool {
+		switch n := n.(type) {
+		case nil:
+			nils++
+		case *Identifier:
+			names = append(names, n.Value)
+		case *FunctionLiteral:
+			return false
+		}
+
+		return true
+	})
+
+	if got := strings.Join(names, " "); got != "z" {
+		t.Errorf("wrong identifiers. expected=%q, got=%q", "z", got)
+	}
+
+	// Program, 2つの ExpressionStatement, z の4つ. 辿らなかった FunctionLiteral では f(nil) を呼ばない
+	if nils != 4 {
+		t.Errorf("f(nil) called %d times, want 4", nils)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/naronA/monkey
 
-go 1.12
+go 1.20
 
 require (
 	golang.org/x/crypto v0.0.0-20190911031432-227b76d455e7 // indirect
@@ -0,0 +1,40 @@
+package lexer
+
+import (
+	"fmt"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+// ErrorKind は字句エラーの種類
+type ErrorKind int
+
+const (
+	_                      ErrorKind = iota
+	ErrIllegalCharacter              // トークンの始まりにならない文字
+	ErrInvalidUTF8                   // 不正なUTF-8のバイト列
+	ErrUnterminatedString            // 閉じる " がないまま入力が終わった
+	ErrInvalidEscape                 // 文字列中の不正なエスケープシーケンス
+	ErrInvalidNumber                 // 不正な数値リテラル
+	ErrUnterminatedComment           // 閉じる */ がないまま入力が終わった
+)
+
+// Error は字句解析中に見つかったエラー. エラーになった箇所は ILLEGAL トークンとして返される
+type Error struct {
+	Kind ErrorKind
+	Pos  mtoken.Position
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// Errors はこれまでに見つかった字句エラーを返す
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) addError(kind ErrorKind, pos mtoken.Position, msg string) {
+	l.errors = append(l.errors, &Error{Kind: kind, Pos: pos, Msg: msg})
+}
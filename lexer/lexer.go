@@ -1,39 +1,100 @@
 package lexer
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/naronA/monkey/mtoken"
 )
 
+// Mode は字句解析器の動作を切り替えるフラグ
+type Mode uint
+
+const (
+	// ScanComments を指定するとコメントを読み捨てずに、次のトークンの Comments に付ける
+	ScanComments Mode = 1 << iota
+)
+
 type Lexer struct {
+	// Mode は NextToken を呼ぶ前に設定する
+	Mode Mode
+
+	filename     string
 	input        string
-	position     int
-	readPosition int
-	ch           byte
+	position     int  // 現在の文字 ch の先頭のバイト位置
+	readPosition int  // 次の文字の先頭のバイト位置
+	ch           rune // 入力はUTF-8としてルーン単位で読む
+	invalid      bool // ch が不正なUTF-8のバイト列から読まれた
+
+	errors []*Error
+
+	// 現在の文字 ch の行と列 (1 始まり)
+	line   int
+	column int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile はトークンの位置情報にファイル名を含める Lexer を返す
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{filename: filename, input: input, line: 1}
 	l.readChar()
 
 	return l
 }
 
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	// 既に入力の終端に達している
+	if l.readPosition > len(l.input) {
+		return
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.column++
 	}
 
 	l.position = l.readPosition
-	l.readPosition++
+
+	if l.readPosition >= len(l.input) {
+		l.ch = 0
+		l.invalid = false
+		l.readPosition++
+
+		return
+	}
+
+	r, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = r
+	l.invalid = r == utf8.RuneError && width == 1
+	l.readPosition += width
 }
 
 func (l *Lexer) NextToken() mtoken.Token {
+	comments := l.skipWhitespaceAndComments()
+
+	tok := l.readToken()
+	tok.End = l.currentPosition()
+
+	if l.Mode&ScanComments != 0 {
+		tok.Comments = comments
+	}
+
+	return tok
+}
+
+func (l *Lexer) readToken() mtoken.Token {
 
 	var tok mtoken.Token
 
-	l.skipWhitespace()
+	pos := l.currentPosition()
 
 	switch l.ch {
 	case '=':
@@ -46,9 +107,23 @@ func (l *Lexer) NextToken() mtoken.Token {
 			tok = newToken(mtoken.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(mtoken.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.PLUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(mtoken.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(mtoken.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.MINUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(mtoken.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -59,13 +134,80 @@ func (l *Lexer) NextToken() mtoken.Token {
 			tok = newToken(mtoken.BANNG, l.ch)
 		}
 	case '/':
-		tok = newToken(mtoken.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.SLASH_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(mtoken.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(mtoken.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.POW, Literal: literal}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.ASTERISK_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(mtoken.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(mtoken.PERCENT, l.ch)
+	case '^':
+		tok = newToken(mtoken.CARET, l.ch)
+	case '~':
+		tok = newToken(mtoken.TILDE, l.ch)
 	case '<':
-		tok = newToken(mtoken.LT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.LTE, Literal: literal}
+		} else if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.LSHIFT, Literal: literal}
+		} else {
+			tok = newToken(mtoken.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(mtoken.GT, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.GTE, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.RSHIFT, Literal: literal}
+		} else {
+			tok = newToken(mtoken.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.AND, Literal: literal}
+		} else {
+			tok = newToken(mtoken.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = mtoken.Token{Type: mtoken.OR, Literal: literal}
+		} else {
+			tok = newToken(mtoken.PIPE, l.ch)
+		}
 	case ';':
 		tok = newToken(mtoken.SEMICOLON, l.ch)
 	case '(':
@@ -74,76 +216,385 @@ func (l *Lexer) NextToken() mtoken.Token {
 		tok = newToken(mtoken.RPAREN, l.ch)
 	case ',':
 		tok = newToken(mtoken.COMMA, l.ch)
+	case ':':
+		tok = newToken(mtoken.COLON, l.ch)
+	case '.':
+		tok = newToken(mtoken.DOT, l.ch)
 	case '{':
 		tok = newToken(mtoken.LBRACE, l.ch)
 	case '}':
 		tok = newToken(mtoken.RBRACE, l.ch)
+	case '[':
+		tok = newToken(mtoken.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(mtoken.RBRACKET, l.ch)
+	case '"':
+		tok = l.readString(pos)
 	case 0:
+		if !l.atEOF() {
+			tok = l.illegal(pos)
+			break
+		}
+
 		tok.Literal = ""
 		tok.Type = mtoken.EOF
 	default:
+		if l.invalid {
+			tok = mtoken.Token{Type: mtoken.ILLEGAL, Literal: l.input[l.position:l.readPosition]}
+			l.addError(ErrInvalidUTF8, pos, fmt.Sprintf("invalid UTF-8 encoding %q", tok.Literal))
+			break
+		}
+
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = mtoken.LookupIdent(tok.Literal)
+			tok.Pos = pos
 
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = mtoken.INT
-			tok.Literal = l.readNumber()
+			tok = l.readNumber(pos)
+			tok.Pos = pos
 
 			return tok
 		}
 
-		tok = newToken(mtoken.ILLEGAL, l.ch)
+		tok = l.illegal(pos)
 	}
 
+	tok.Pos = pos
+
 	l.readChar()
 
 	return tok
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
+/*
+ダブルクォートで囲まれた文字列を読む. l.chは開きの「"」
+トークンのリテラルはエスケープを解釈した後の中身で、閉じの「"」がcurになった状態で戻る
+閉じの「"」がないまま入力が終わったら、文字列の始まりの位置でエラーにする
+*/
+func (l *Lexer) readString(start mtoken.Position) mtoken.Token {
+	var out strings.Builder
 
-	for isDigit(l.ch) {
+	for {
 		l.readChar()
+
+		switch {
+		case l.ch == '"':
+			return mtoken.Token{Type: mtoken.STRING, Literal: out.String()}
+		case l.atEOF():
+			l.addError(ErrUnterminatedString, start, "unterminated string literal")
+			return mtoken.Token{Type: mtoken.ILLEGAL, Literal: l.input[start.Offset:l.position]}
+		case l.invalid:
+			l.addError(ErrInvalidUTF8, l.currentPosition(), fmt.Sprintf("invalid UTF-8 encoding %q", l.input[l.position:l.readPosition]))
+		case l.ch == '\\':
+			l.readEscape(&out)
+		default:
+			out.WriteRune(l.ch)
+		}
 	}
+}
 
-	return l.input[position:l.position]
+// readEscape は「\」の次の文字を読み、エスケープされた文字をoutに書き込む
+func (l *Lexer) readEscape(out *strings.Builder) {
+	pos := l.currentPosition()
+
+	switch l.peekChar() {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case '"':
+		out.WriteRune('"')
+	case '\\':
+		out.WriteRune('\\')
+	case 'u':
+		l.readChar()
+		l.readUnicodeEscape(pos, out)
+		return
+	default:
+		// 閉じの「"」や入力の終わりは読み進めずに readString に任せる
+		if l.peekChar() == 0 {
+			return
+		}
+
+		l.addError(ErrInvalidEscape, pos, fmt.Sprintf("unknown escape sequence \\%c", l.peekChar()))
+	}
+
+	l.readChar()
 }
 
-func isDigit(ch byte) bool {
+// readUnicodeEscape は \u{XXXX} 形式のエスケープを読む. l.chは「u」
+func (l *Lexer) readUnicodeEscape(pos mtoken.Position, out *strings.Builder) {
+	if l.peekChar() != '{' {
+		l.addError(ErrInvalidEscape, pos, "invalid unicode escape, expected \\u{...}")
+		return
+	}
+
+	l.readChar()
+
+	digits := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	hex := l.input[digits:l.readPosition]
+
+	if l.peekChar() != '}' {
+		l.addError(ErrInvalidEscape, pos, "invalid unicode escape, expected \\u{...}")
+		return
+	}
+
+	l.readChar()
+
+	code, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) > 6 || !utf8.ValidRune(rune(code)) {
+		l.addError(ErrInvalidEscape, pos, fmt.Sprintf("invalid unicode code point \\u{%s}", hex))
+		return
+	}
+
+	out.WriteRune(rune(code))
+}
+
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func (l *Lexer) illegal(pos mtoken.Position) mtoken.Token {
+	l.addError(ErrIllegalCharacter, pos, fmt.Sprintf("illegal character %q", l.ch))
+
+	return newToken(mtoken.ILLEGAL, l.ch)
+}
+
+func (l *Lexer) currentPosition() mtoken.Position {
+	return mtoken.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+var baseNames = map[int]string{
+	2:  "binary",
+	8:  "octal",
+	16: "hexadecimal",
+}
+
+/*
+数値リテラルを読む
+
+	10進数: 123, 1_000_000
+	16進数: 0x1F, 8進数: 0o17, 2進数: 0b1010
+	0 で始まる10進数の整数 (017 など) はエラー
+	浮動小数点数: 1.5, 1e10, 2.5E-3
+
+リテラルはソースのままの文字列で、値への変換は構文解析器が行う
+*/
+func (l *Lexer) readNumber(start mtoken.Position) mtoken.Token {
+	typ := mtoken.TokenType(mtoken.INT)
+	base := 10
+
+	if l.ch == '0' {
+		switch l.peekChar() {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	var msg string
+
+	if base != 10 {
+		// 0x などのプレフィックスを読み飛ばす
+		l.readChar()
+		l.readChar()
+
+		digits, ok := l.readDigits(base)
+
+		switch {
+		case digits == 0:
+			msg = fmt.Sprintf("%s literal has no digits", baseNames[base])
+		case !ok:
+			msg = "'_' must separate successive digits"
+		case isDigit(l.ch):
+			msg = fmt.Sprintf("invalid digit %q in %s literal", l.ch, baseNames[base])
+			for isDigit(l.ch) {
+				l.readChar()
+			}
+		}
+	} else {
+		digits, ok := l.readDigits(10)
+
+		// 小数部
+		if l.ch == '.' && isDigit(l.peekChar()) {
+			typ = mtoken.FLOAT
+			l.readChar()
+			_, fracOK := l.readDigits(10)
+			ok = ok && fracOK
+		}
+
+		// 指数部
+		if l.ch == 'e' || l.ch == 'E' {
+			typ = mtoken.FLOAT
+			l.readChar()
+
+			if l.ch == '+' || l.ch == '-' {
+				l.readChar()
+			}
+
+			digits, expOK := l.readDigits(10)
+			if digits == 0 {
+				msg = "exponent has no digits"
+			}
+			ok = ok && expOK
+		}
+
+		switch {
+		case msg != "":
+		case !ok:
+			msg = "'_' must separate successive digits"
+		case typ == mtoken.INT && digits > 1 && l.input[start.Offset] == '0':
+			// 017 を8進数と読むか10進数と読むかは言語によって違うので、どちらにも読まない
+			msg = "leading zero in decimal literal (use 0o for octal)"
+		}
+	}
+
+	literal := l.input[start.Offset:l.position]
+
+	if msg != "" {
+		l.addError(ErrInvalidNumber, start, msg)
+		return mtoken.Token{Type: mtoken.ILLEGAL, Literal: literal}
+	}
+
+	return mtoken.Token{Type: typ, Literal: literal}
+}
+
+// readDigits は base 進数の数字と区切りの「_」を読み、数字の個数を返す
+// 「_」が数字と数字の間以外にあればokはfalseになる
+func (l *Lexer) readDigits(base int) (digits int, ok bool) {
+	ok = true
+	underscore := false
+
+	for {
+		if l.ch == '_' {
+			if digits == 0 || underscore {
+				ok = false
+			}
+			underscore = true
+		} else if digitVal(l.ch) < base {
+			digits++
+			underscore = false
+		} else {
+			break
+		}
+
+		l.readChar()
+	}
+
+	return digits, ok && !underscore
+}
+
+func digitVal(ch rune) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch - 'a' + 10)
+	case 'A' <= ch && ch <= 'F':
+		return int(ch - 'A' + 10)
+	}
+
+	return 16
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
+// skipWhitespaceAndComments は空白とコメントを読み飛ばし、読み飛ばしたコメントを返す
+func (l *Lexer) skipWhitespaceAndComments() []mtoken.Comment {
+	var comments []mtoken.Comment
+
+	for {
+		l.skipWhitespace()
+
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+
+		comments = append(comments, l.readComment())
+	}
+}
+
+// readComment は // から行末まで、または /* から */ までを読む. l.chは先頭の「/」
+func (l *Lexer) readComment() mtoken.Comment {
+	pos := l.currentPosition()
+
+	l.readChar()
+
+	if l.ch == '/' {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+	} else {
+		l.readChar()
+
+		for !(l.ch == '*' && l.peekChar() == '/') {
+			if l.atEOF() {
+				l.addError(ErrUnterminatedComment, pos, "unterminated block comment")
+				return mtoken.Comment{Text: l.input[pos.Offset:], Pos: pos}
+			}
+
+			l.readChar()
+		}
+
+		// 閉じの「*/」を読み飛ばす
+		l.readChar()
+		l.readChar()
+	}
+
+	return mtoken.Comment{Text: l.input[pos.Offset:l.position], Pos: pos}
+}
+
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
 	}
 }
 
-func newToken(mtokenType mtoken.TokenType, ch byte) mtoken.Token {
+func newToken(mtokenType mtoken.TokenType, ch rune) mtoken.Token {
 	return mtoken.Token{Type: mtokenType, Literal: string(ch)}
 }
 
 func (l *Lexer) readIdentifier() string {
 	position := l.position
 
-	for isLetter(l.ch) {
+	// 2文字目以降は数字も使える (x1, 数値2 など)
+	for !l.invalid && (isLetter(l.ch) || unicode.IsDigit(l.ch)) {
 		l.readChar()
 	}
 
 	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// isLetter は識別子の先頭に使える文字かどうかを返す. 日本語などのUnicodeの文字も含む
+func isLetter(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-func (l *Lexer) peekChar() byte {
-	if l.readPosition > len(l.input) {
+func (l *Lexer) peekChar() rune {
+	if l.readPosition >= len(l.input) {
 		return 0
 	}
 
-	return l.input[l.readPosition]
+	r, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+
+	return r
 }
@@ -51,7 +51,7 @@ let add = fn(x, y) {
 	x + y;
 };
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if ( 5 < 10 ) {
@@ -106,7 +106,7 @@ if ( 5 < 10 ) {
 		{mtoken.IDENT, "ten"},
 		{mtoken.RPAREN, ")"},
 		{mtoken.SEMICOLON, ";"},
-		//!-/*5;
+		//!-/ *5;
 		{mtoken.BANNG, "!"},
 		{mtoken.MINUS, "-"},
 		{mtoken.SLASH, "/"},
@@ -270,3 +270,696 @@ func TestNextToken1(t *testing.T) {
 
 	}
 }
+
+func TestNextTokenAtEndOfInput(t *testing.T) {
+	inputs := []string{"=", "!", "let x ="}
+
+	for _, input := range inputs {
+		l := New(input)
+
+		var tok mtoken.Token
+		for i := 0; i < 10 && tok.Type != mtoken.EOF; i++ {
+			tok = l.NextToken()
+		}
+
+		if tok.Type != mtoken.EOF {
+			t.Errorf("lexer did not reach EOF for %q", input)
+		}
+	}
+}
+
+func TestNextTokenPosition(t *testing.T) {
+	input := `let five = 5;
+let add = fn(x) {
+	x;
+};`
+	tests := []struct {
+		expectedType   mtoken.TokenType
+		expectedOffset int
+		expectedLine   int
+		expectedColumn int
+	}{
+		{mtoken.LET, 0, 1, 1},
+		{mtoken.IDENT, 4, 1, 5},
+		{mtoken.ASSIGN, 9, 1, 10},
+		{mtoken.INT, 11, 1, 12},
+		{mtoken.SEMICOLON, 12, 1, 13},
+		{mtoken.LET, 14, 2, 1},
+		{mtoken.IDENT, 18, 2, 5},
+		{mtoken.ASSIGN, 22, 2, 9},
+		{mtoken.FUNCTION, 24, 2, 11},
+		{mtoken.LPAREN, 26, 2, 13},
+		{mtoken.IDENT, 27, 2, 14},
+		{mtoken.RPAREN, 28, 2, 15},
+		{mtoken.LBRACE, 30, 2, 17},
+		{mtoken.IDENT, 33, 3, 2},
+		{mtoken.SEMICOLON, 34, 3, 3},
+		{mtoken.RBRACE, 36, 4, 1},
+		{mtoken.SEMICOLON, 37, 4, 2},
+		{mtoken.EOF, 38, 4, 3},
+		{mtoken.EOF, 38, 4, 3},
+	}
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos.Filename != "test.mk" {
+			t.Fatalf("tests[%d] - filename wrong. got=%q", i, tok.Pos.Filename)
+		}
+
+		if tok.Pos.Offset != tt.expectedOffset || tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d(%d:%d), got=%d(%d:%d)",
+				i, tt.expectedOffset, tt.expectedLine, tt.expectedColumn,
+				tok.Pos.Offset, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := `let 数値 = café + x1;
+数値2 != _名前`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{mtoken.LET, "let", 1},
+		{mtoken.IDENT, "数値", 5},
+		{mtoken.ASSIGN, "=", 8},
+		{mtoken.IDENT, "café", 10},
+		{mtoken.PLUS, "+", 15},
+		{mtoken.IDENT, "x1", 17},
+		{mtoken.SEMICOLON, ";", 19},
+		{mtoken.IDENT, "数値2", 1},
+		{mtoken.NOTEQ, "!=", 5},
+		{mtoken.IDENT, "_名前", 8},
+		{mtoken.EOF, "", 11},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %v", l.Errors())
+	}
+}
+
+func TestNextTokenErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedKind    ErrorKind
+		expectedMsg     string
+	}{
+		{"\xff", "\xff", ErrInvalidUTF8, `1:1: invalid UTF-8 encoding "\xff"`},
+		{"x \xe6\x95", "\xe6", ErrInvalidUTF8, `1:3: invalid UTF-8 encoding "\xe6"`},
+		{"x @", "@", ErrIllegalCharacter, `1:3: illegal character '@'`},
+		{"x \x00", "\x00", ErrIllegalCharacter, `1:3: illegal character '\x00'`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		var illegal mtoken.Token
+		for tok := l.NextToken(); tok.Type != mtoken.EOF; tok = l.NextToken() {
+			if tok.Type == mtoken.ILLEGAL && illegal.Type == "" {
+				illegal = tok
+			}
+		}
+
+		if illegal.Literal != tt.expectedLiteral {
+			t.Errorf("%q: illegal literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, illegal.Literal)
+		}
+
+		errs := l.Errors()
+		if len(errs) == 0 {
+			t.Fatalf("%q: expected lexer errors, got none", tt.input)
+		}
+
+		if errs[0].Kind != tt.expectedKind {
+			t.Errorf("%q: error kind wrong. expected=%d, got=%d", tt.input, tt.expectedKind, errs[0].Kind)
+		}
+
+		if errs[0].Error() != tt.expectedMsg {
+			t.Errorf("%q: error wrong. expected=%q, got=%q", tt.input, tt.expectedMsg, errs[0].Error())
+		}
+	}
+}
+
+func TestNextTokenString(t *testing.T) {
+	input := `"foobar" "foo bar" "" "a\nb\t\"c\"\\" "\u{65e5}\u{1F600}" "改行
+を含む"`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.STRING, "foobar"},
+		{mtoken.STRING, "foo bar"},
+		{mtoken.STRING, ""},
+		{mtoken.STRING, "a\nb\t\"c\"\\"},
+		{mtoken.STRING, "日😀"},
+		{mtoken.STRING, "改行\nを含む"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("lexer has errors: %v", l.Errors())
+	}
+}
+
+func TestNextTokenStringErrors(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType mtoken.TokenType
+		expectedKind ErrorKind
+		expectedMsg  string
+	}{
+		{"let s = \"abc", mtoken.ILLEGAL, ErrUnterminatedString, "1:9: unterminated string literal"},
+		{"\n  \"abc\\", mtoken.ILLEGAL, ErrUnterminatedString, "2:3: unterminated string literal"},
+		{`"a\qb"`, mtoken.STRING, ErrInvalidEscape, `1:3: unknown escape sequence \q`},
+		{`"\u0041"`, mtoken.STRING, ErrInvalidEscape, `1:2: invalid unicode escape, expected \u{...}`},
+		{`"\u{41"`, mtoken.STRING, ErrInvalidEscape, `1:2: invalid unicode escape, expected \u{...}`},
+		{`"\u{D800}"`, mtoken.STRING, ErrInvalidEscape, `1:2: invalid unicode code point \u{D800}`},
+		{`"\u{}"`, mtoken.STRING, ErrInvalidEscape, `1:2: invalid unicode code point \u{}`},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		var tok mtoken.Token
+		for tok = l.NextToken(); tok.Type != mtoken.STRING && tok.Type != mtoken.ILLEGAL; tok = l.NextToken() {
+			if tok.Type == mtoken.EOF {
+				t.Fatalf("%q: no string token", tt.input)
+			}
+		}
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("%q: tokentype wrong. expected=%q, got=%q", tt.input, tt.expectedType, tok.Type)
+		}
+
+		if l.NextToken().Type != mtoken.EOF {
+			t.Errorf("%q: expected EOF after string", tt.input)
+		}
+
+		errs := l.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("%q: expected 1 lexer error, got %v", tt.input, errs)
+		}
+
+		if errs[0].Kind != tt.expectedKind {
+			t.Errorf("%q: error kind wrong. expected=%d, got=%d", tt.input, tt.expectedKind, errs[0].Kind)
+		}
+
+		if errs[0].Error() != tt.expectedMsg {
+			t.Errorf("%q: error wrong. expected=%q, got=%q", tt.input, tt.expectedMsg, errs[0].Error())
+		}
+	}
+}
+
+func TestNextTokenNumber(t *testing.T) {
+	input := `0 123 1_000_000 0x1F 0XdeadBEEF 0o17 0O7_7 0b1010 0B1_0 1.5 0.25 1e10 2.5E-3 6_0.0_1e+1_0 1.x 5abc`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.INT, "0"},
+		{mtoken.INT, "123"},
+		{mtoken.INT, "1_000_000"},
+		{mtoken.INT, "0x1F"},
+		{mtoken.INT, "0XdeadBEEF"},
+		{mtoken.INT, "0o17"},
+		{mtoken.INT, "0O7_7"},
+		{mtoken.INT, "0b1010"},
+		{mtoken.INT, "0B1_0"},
+		{mtoken.FLOAT, "1.5"},
+		{mtoken.FLOAT, "0.25"},
+		{mtoken.FLOAT, "1e10"},
+		{mtoken.FLOAT, "2.5E-3"},
+		{mtoken.FLOAT, "6_0.0_1e+1_0"},
+		{mtoken.INT, "1"},
+		{mtoken.DOT, "."},
+		{mtoken.IDENT, "x"},
+		{mtoken.INT, "5"},
+		{mtoken.IDENT, "abc"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenNumberErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedMsg     string
+	}{
+		{"0x", "0x", "1:1: hexadecimal literal has no digits"},
+		{"x = 0b;", "0b", "1:5: binary literal has no digits"},
+		{"0b102", "0b102", `1:1: invalid digit '2' in binary literal`},
+		{"0o78", "0o78", `1:1: invalid digit '8' in octal literal`},
+		{"1__000", "1__000", "1:1: '_' must separate successive digits"},
+		{"1000_", "1000_", "1:1: '_' must separate successive digits"},
+		{"0x_1F", "0x_1F", "1:1: '_' must separate successive digits"},
+		{"1._5", "1", ""},
+		{"1.5_", "1.5_", "1:1: '_' must separate successive digits"},
+		{"1e", "1e", "1:1: exponent has no digits"},
+		{"1e+", "1e+", "1:1: exponent has no digits"},
+		{"017", "017", "1:1: leading zero in decimal literal (use 0o for octal)"},
+		{"0_1", "0_1", "1:1: leading zero in decimal literal (use 0o for octal)"},
+		{"x[00]", "00", "1:3: leading zero in decimal literal (use 0o for octal)"},
+		{"0.5 + 017.5", "017.5", ""},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+
+		var tok mtoken.Token
+		for tok = l.NextToken(); tok.Pos.Offset < len(tt.input) && tok.Literal != tt.expectedLiteral; tok = l.NextToken() {
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("%q: literal wrong. expected=%q, got=%q", tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedMsg == "" {
+			continue
+		}
+
+		if tok.Type != mtoken.ILLEGAL {
+			t.Errorf("%q: tokentype wrong. expected=%q, got=%q", tt.input, mtoken.ILLEGAL, tok.Type)
+		}
+
+		errs := l.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("%q: expected 1 lexer error, got %v", tt.input, errs)
+		}
+
+		if errs[0].Kind != ErrInvalidNumber {
+			t.Errorf("%q: error kind wrong. got=%d", tt.input, errs[0].Kind)
+		}
+
+		if errs[0].Error() != tt.expectedMsg {
+			t.Errorf("%q: error wrong. expected=%q, got=%q", tt.input, tt.expectedMsg, errs[0].Error())
+		}
+	}
+}
+
+func TestNextTokenComments(t *testing.T) {
+	input := `// 先頭のコメント
+let x = 10 / 2; // 行末のコメント
+/* ブロック
+   コメント */ x/*間*/+ 1
+// 最後のコメント`
+	tests := []struct {
+		expectedType     mtoken.TokenType
+		expectedLiteral  string
+		expectedComments []string
+	}{
+		{mtoken.LET, "let", []string{"// 先頭のコメント"}},
+		{mtoken.IDENT, "x", nil},
+		{mtoken.ASSIGN, "=", nil},
+		{mtoken.INT, "10", nil},
+		{mtoken.SLASH, "/", nil},
+		{mtoken.INT, "2", nil},
+		{mtoken.SEMICOLON, ";", nil},
+		{mtoken.IDENT, "x", []string{"// 行末のコメント", "/* ブロック\n   コメント */"}},
+		{mtoken.PLUS, "+", []string{"/*間*/"}},
+		{mtoken.INT, "1", nil},
+		{mtoken.EOF, "", []string{"// 最後のコメント"}},
+	}
+
+	for _, mode := range []Mode{0, ScanComments} {
+		l := New(input)
+		l.Mode = mode
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+
+			if tok.Type != tt.expectedType {
+				t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+					i, tt.expectedType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+					i, tt.expectedLiteral, tok.Literal)
+			}
+
+			expected := tt.expectedComments
+			if mode&ScanComments == 0 {
+				expected = nil
+			}
+
+			if len(tok.Comments) != len(expected) {
+				t.Fatalf("tests[%d] - comments wrong. expected=%q, got=%v",
+					i, expected, tok.Comments)
+			}
+
+			for j, text := range expected {
+				if tok.Comments[j].Text != text {
+					t.Errorf("tests[%d] - comment[%d] wrong. expected=%q, got=%q",
+						i, j, text, tok.Comments[j].Text)
+				}
+			}
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Errorf("lexer has errors: %v", l.Errors())
+		}
+	}
+}
+
+func TestNextTokenCommentPosition(t *testing.T) {
+	l := New("x\n  /* a */ y")
+	l.Mode = ScanComments
+
+	l.NextToken()
+	tok := l.NextToken()
+
+	if len(tok.Comments) != 1 {
+		t.Fatalf("comments wrong. got=%v", tok.Comments)
+	}
+
+	if pos := tok.Comments[0].Pos; pos.Line != 2 || pos.Column != 3 || pos.Offset != 4 {
+		t.Errorf("comment position wrong. got=%d(%s)", pos.Offset, pos)
+	}
+
+	if pos := tok.Pos; pos.Line != 2 || pos.Column != 11 {
+		t.Errorf("token position wrong. got=%s", pos)
+	}
+}
+
+func TestNextTokenUnterminatedComment(t *testing.T) {
+	l := New("let x = 1;\n  /* コメント")
+
+	for tok := l.NextToken(); tok.Type != mtoken.EOF; tok = l.NextToken() {
+	}
+
+	errs := l.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 lexer error, got %v", errs)
+	}
+
+	if errs[0].Kind != ErrUnterminatedComment {
+		t.Errorf("error kind wrong. got=%d", errs[0].Kind)
+	}
+
+	if errs[0].Error() != "2:3: unterminated block comment" {
+		t.Errorf("error wrong. got=%q", errs[0].Error())
+	}
+}
+
+func TestNextTokenComparisonAndLogical(t *testing.T) {
+	input := `if (x >= 0 && x <= n || !ok) < > & |`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.IF, "if"},
+		{mtoken.LPAREN, "("},
+		{mtoken.IDENT, "x"},
+		{mtoken.GTE, ">="},
+		{mtoken.INT, "0"},
+		{mtoken.AND, "&&"},
+		{mtoken.IDENT, "x"},
+		{mtoken.LTE, "<="},
+		{mtoken.IDENT, "n"},
+		{mtoken.OR, "||"},
+		{mtoken.BANNG, "!"},
+		{mtoken.IDENT, "ok"},
+		{mtoken.RPAREN, ")"},
+		{mtoken.LT, "<"},
+		{mtoken.GT, ">"},
+		{mtoken.AMPERSAND, "&"},
+		{mtoken.PIPE, "|"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenArithmeticAndBitwise(t *testing.T) {
+	input := `a % b ** c * d & e | f ^ ~g << 2 >> 1 <<= >>=`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.IDENT, "a"},
+		{mtoken.PERCENT, "%"},
+		{mtoken.IDENT, "b"},
+		{mtoken.POW, "**"},
+		{mtoken.IDENT, "c"},
+		{mtoken.ASTERISK, "*"},
+		{mtoken.IDENT, "d"},
+		{mtoken.AMPERSAND, "&"},
+		{mtoken.IDENT, "e"},
+		{mtoken.PIPE, "|"},
+		{mtoken.IDENT, "f"},
+		{mtoken.CARET, "^"},
+		{mtoken.TILDE, "~"},
+		{mtoken.IDENT, "g"},
+		{mtoken.LSHIFT, "<<"},
+		{mtoken.INT, "2"},
+		{mtoken.RSHIFT, ">>"},
+		{mtoken.INT, "1"},
+		{mtoken.LSHIFT, "<<"},
+		{mtoken.ASSIGN, "="},
+		{mtoken.RSHIFT, ">>"},
+		{mtoken.ASSIGN, "="},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenBrackets(t *testing.T) {
+	input := `[1, 2][0]`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.LBRACKET, "["},
+		{mtoken.INT, "1"},
+		{mtoken.COMMA, ","},
+		{mtoken.INT, "2"},
+		{mtoken.RBRACKET, "]"},
+		{mtoken.LBRACKET, "["},
+		{mtoken.INT, "0"},
+		{mtoken.RBRACKET, "]"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenLoopKeywords(t *testing.T) {
+	input := `while for in break continue inside`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.WHILE, "while"},
+		{mtoken.FOR, "for"},
+		{mtoken.IN, "in"},
+		{mtoken.BREAK, "break"},
+		{mtoken.CONTINUE, "continue"},
+		{mtoken.IDENT, "inside"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenAssignOperators(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; h.name = x ** 2;`
+	tests := []struct {
+		expectedType    mtoken.TokenType
+		expectedLiteral string
+	}{
+		{mtoken.IDENT, "x"},
+		{mtoken.ASSIGN, "="},
+		{mtoken.INT, "1"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.IDENT, "x"},
+		{mtoken.PLUS_ASSIGN, "+="},
+		{mtoken.INT, "2"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.IDENT, "x"},
+		{mtoken.MINUS_ASSIGN, "-="},
+		{mtoken.INT, "3"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.IDENT, "x"},
+		{mtoken.ASTERISK_ASSIGN, "*="},
+		{mtoken.INT, "4"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.IDENT, "x"},
+		{mtoken.SLASH_ASSIGN, "/="},
+		{mtoken.INT, "5"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.IDENT, "h"},
+		{mtoken.DOT, "."},
+		{mtoken.IDENT, "name"},
+		{mtoken.ASSIGN, "="},
+		{mtoken.IDENT, "x"},
+		{mtoken.POW, "**"},
+		{mtoken.INT, "2"},
+		{mtoken.SEMICOLON, ";"},
+		{mtoken.EOF, ""},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenEnd(t *testing.T) {
+	input := "let café = \"a\\tb\";\n1_000 >= x"
+	tests := []struct {
+		expectedLiteral string
+		expectedSource  string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", "let", 1, 4},
+		{"café", "café", 1, 9},
+		{"=", "=", 1, 11},
+		{"a\tb", `"a\tb"`, 1, 18},
+		{";", ";", 1, 19},
+		{"1_000", "1_000", 2, 6},
+		{">=", ">=", 2, 9},
+		{"x", "x", 2, 11},
+		{"", "", 2, 11},
+	}
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if source := input[tok.Pos.Offset:tok.End.Offset]; source != tt.expectedSource {
+			t.Errorf("tests[%d] - source wrong. expected=%q, got=%q", i, tt.expectedSource, source)
+		}
+
+		if tok.End.Line != tt.expectedLine || tok.End.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - end wrong. expected=%d:%d, got=%s",
+				i, tt.expectedLine, tt.expectedColumn, tok.End)
+		}
+	}
+}
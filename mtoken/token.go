@@ -1,20 +1,66 @@
 package mtoken
 
+import "fmt"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	Pos     Position // トークンの先頭文字の位置
+	End     Position // トークンの直後の文字の位置
+
+	// 直前のトークンとの間にあったコメント. 字句解析器で ScanComments を指定したときだけ設定される
+	Comments []Comment
+}
+
+// Comment は // または /* */ のコメント1つ. Text は // や /* */ を含むソースのままの文字列
+type Comment struct {
+	Text string
+	Pos  Position
+}
+
+// Position はソース上の位置を表す. Line と Column は 1 始まり、Offset は 0 始まりのバイト位置
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid は位置情報が設定されているかどうかを返す
+func (pos Position) IsValid() bool { return pos.Line > 0 }
+
+// String は file:line:col 形式の文字列を返す. ファイル名がなければ line:col になる
+func (pos Position) String() string {
+	s := pos.Filename
+	if pos.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+	}
+
+	if s == "" {
+		s = "-"
+	}
+
+	return s
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"true":     TRUE,
+	"false":    FALSE,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -32,6 +78,8 @@ const (
 	// 識別子 + リテラル
 	IDENT  = "IDENT"
 	INT    = "INT"
+	FLOAT  = "FLOAT"
+	STRING = "STRING"
 	TRUE   = "TRUE"
 	FALSE  = "FALSE"
 	IF     = "IF"
@@ -47,20 +95,51 @@ const (
 	BANNG    = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POW      = "**"
 
-	LT = "<"
-	GT = ">"
+	// ビット演算子
+	AMPERSAND = "&"
+	PIPE      = "|"
+	CARET     = "^"
+	TILDE     = "~"
+	LSHIFT    = "<<"
+	RSHIFT    = ">>"
+
+	LT  = "<"
+	GT  = ">"
+	LTE = "<="
+	GTE = ">="
+
+	AND = "&&"
+	OR  = "||"
+
+	// 代入演算子
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 )
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/naronA/monkey/mtoken"
+)
+
+// ErrorKind は構文エラーの種類
+type ErrorKind int
+
+const (
+	_                     ErrorKind = iota
+	ErrUnexpectedToken              // 期待したトークンと違うトークンが来た
+	ErrUnexpectedEOF                // 構文の途中で入力が終わった
+	ErrNoPrefixParseFn              // 式の先頭に置けないトークンが来た
+	ErrInvalidNumber                // 数値リテラル (整数または浮動小数点数) として解釈できない
+	ErrReturnInExpression           // 式の位置に return が書かれた
+	ErrLexical                      // 字句エラー. Err に *lexer.Error が入る
+	ErrNumberOutOfRange             // 数値リテラルが表現できる範囲を超えている
+	ErrOutsideLoop                  // ループの外に break や continue が書かれた
+	ErrInvalidAssignment            // 代入できない式が代入の左辺に書かれた
+	ErrExtension                    // オプションで登録した構文解析関数が Errorf で報告したエラー
+)
+
+// Deprecated: ErrInvalidInteger は ErrInvalidNumber の古い名前. 浮動小数点数のエラーにも使うので改名した
+const ErrInvalidInteger = ErrInvalidNumber
+
+var errorKindNames = map[ErrorKind]string{
+	ErrUnexpectedToken:    "unexpected token",
+	ErrUnexpectedEOF:      "unexpected end of input",
+	ErrNoPrefixParseFn:    "no prefix parse function",
+	ErrInvalidNumber:      "invalid number literal",
+	ErrReturnInExpression: "return in expression",
+	ErrLexical:            "lexical error",
+	ErrNumberOutOfRange:   "number out of range",
+	ErrOutsideLoop:        "break or continue outside loop",
+	ErrInvalidAssignment:  "invalid assignment target",
+	ErrExtension:          "extension error",
+}
+
+func (k ErrorKind) String() string {
+	if name, ok := errorKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
+// ParseError は構文解析中に見つかったエラー1件を表す
+type ParseError struct {
+	Kind     ErrorKind
+	Pos      mtoken.Position    // エラーの原因となったトークンの位置
+	Expected []mtoken.TokenType // 期待していたトークン (なければ nil)
+	Actual   mtoken.Token       // 実際に現れたトークン
+	Msg      string
+	Err      error // 元になったエラー (字句エラーなど). なければ nil
+}
+
+// Error は従来の Errors() と同じ "file:line:col: message" 形式の文字列を返す
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList は ParseError の列. errors.As で個々の *ParseError を取り出せる
+type ErrorList []*ParseError
+
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+}
+
+func (list ErrorList) Unwrap() []error {
+	errs := make([]error, len(list))
+	for i, e := range list {
+		errs[i] = e
+	}
+
+	return errs
+}
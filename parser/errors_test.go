@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/naronA/monkey/lexer"
+	"github.com/naronA/monkey/mtoken"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedKind   ErrorKind
+		expectedLine   int
+		expectedColumn int
+		expectedTypes  []mtoken.TokenType
+		expectedActual mtoken.TokenType
+	}{
+		{"let 5 = x;", ErrUnexpectedToken, 1, 5, []mtoken.TokenType{mtoken.IDENT}, mtoken.INT},
+		{"let x", ErrUnexpectedEOF, 1, 6, []mtoken.TokenType{mtoken.ASSIGN}, mtoken.EOF},
+		{"1 +", ErrUnexpectedEOF, 1, 4, nil, mtoken.EOF},
+		{"\n  ) + 1", ErrNoPrefixParseFn, 2, 3, nil, mtoken.RPAREN},
+		{"99999999999999999999", ErrNumberOutOfRange, 1, 1, nil, mtoken.INT},
+		{"1e400", ErrNumberOutOfRange, 1, 1, nil, mtoken.FLOAT},
+		{"1 + return", ErrReturnInExpression, 1, 5, nil, mtoken.RETURN},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errs := p.ParseErrors()
+		if len(errs) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		e := errs[0]
+		if e.Kind != tt.expectedKind {
+			t.Errorf("%q: kind wrong. expected=%s, got=%s", tt.input, tt.expectedKind, e.Kind)
+		}
+		if e.Pos.Line != tt.expectedLine || e.Pos.Column != tt.expectedColumn {
+			t.Errorf("%q: position wrong. expected=%d:%d, got=%s", tt.input, tt.expectedLine, tt.expectedColumn, e.Pos)
+		}
+		if len(e.Expected) != len(tt.expectedTypes) {
+			t.Fatalf("%q: expected set wrong. expected=%v, got=%v", tt.input, tt.expectedTypes, e.Expected)
+		}
+		for i, typ := range tt.expectedTypes {
+			if e.Expected[i] != typ {
+				t.Errorf("%q: expected[%d] wrong. expected=%s, got=%s", tt.input, i, typ, e.Expected[i])
+			}
+		}
+		if e.Actual.Type != tt.expectedActual {
+			t.Errorf("%q: actual token wrong. expected=%s, got=%s", tt.input, tt.expectedActual, e.Actual.Type)
+		}
+
+		// 互換用の Errors() は Error() と同じ文字列を返す
+		if p.Errors()[0] != e.Error() {
+			t.Errorf("%q: Errors()[0]=%q, Error()=%q", tt.input, p.Errors()[0], e.Error())
+		}
+	}
+}
+
+func TestInvalidNumberLiteral(t *testing.T) {
+	// 字句解析器は不正な数値を ILLEGAL にするので、トークンを直接置いて確かめる
+	tests := []struct {
+		tok      mtoken.Token
+		expected string
+	}{
+		{mtoken.Token{Type: mtoken.INT, Literal: "12a"}, `could not parse "12a" as integer`},
+		{mtoken.Token{Type: mtoken.FLOAT, Literal: "1.2.3"}, `could not parse "1.2.3" as float`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(""))
+		p.curToken = tt.tok
+
+		if tt.tok.Type == mtoken.INT {
+			p.parseIntegerLiteral()
+		} else {
+			p.parseFloatLiteral()
+		}
+
+		errs := p.ParseErrors()
+		if len(errs) != 1 {
+			t.Fatalf("%q: expected 1 error, got %v", tt.tok.Literal, errs)
+		}
+
+		if errs[0].Kind != ErrInvalidNumber {
+			t.Errorf("%q: kind wrong. expected=%s, got=%s", tt.tok.Literal, ErrInvalidNumber, errs[0].Kind)
+		}
+
+		if errs[0].Msg != tt.expected {
+			t.Errorf("%q: message wrong. expected=%q, got=%q", tt.tok.Literal, tt.expected, errs[0].Msg)
+		}
+	}
+}
+
+func TestErrAs(t *testing.T) {
+	p := New(lexer.New("let 5;"))
+	p.ParseProgram()
+
+	err := p.Err()
+	if err == nil {
+		t.Fatalf("p.Err() returned nil")
+	}
+
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		t.Fatalf("errors.As failed for %T", err)
+	}
+
+	if pe.Kind != ErrUnexpectedToken {
+		t.Errorf("pe.Kind wrong. got=%s", pe.Kind)
+	}
+
+	if err.Error() != "1:5: expected next token to be IDENT, got INT instead" {
+		t.Errorf("err.Error() wrong. got=%q", err.Error())
+	}
+}
+
+func TestErrNil(t *testing.T) {
+	p := New(lexer.New("let x = 5;"))
+	p.ParseProgram()
+
+	if err := p.Err(); err != nil {
+		t.Errorf("p.Err() not nil. got=%v", err)
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	p := New(lexer.New("let 名前 = 1 @ 2;\nlet y = \xff;"))
+	p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) != 2 {
+		t.Fatalf("wrong number of errors. expected=2, got=%d %q", len(errs), p.Errors())
+	}
+
+	expected := []string{
+		`1:12: illegal character '@'`,
+		`2:9: invalid UTF-8 encoding "\xff"`,
+	}
+	for i, msg := range expected {
+		if errs[i].Kind != ErrLexical {
+			t.Errorf("errs[%d].Kind wrong. got=%s", i, errs[i].Kind)
+		}
+		if errs[i].Error() != msg {
+			t.Errorf("errs[%d] wrong. expected=%q, got=%q", i, msg, errs[i].Error())
+		}
+	}
+
+	var lexErr *lexer.Error
+	if !errors.As(p.Err(), &lexErr) {
+		t.Fatalf("errors.As failed for %T", p.Err())
+	}
+	if lexErr.Kind != lexer.ErrIllegalCharacter {
+		t.Errorf("lexErr.Kind wrong. got=%d", lexErr.Kind)
+	}
+}
+
+func TestUnterminatedStringError(t *testing.T) {
+	p := New(lexer.New("let s = \"abc;\nlet t = 1;"))
+	program := p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) != 1 {
+		t.Fatalf("wrong number of errors. expected=1, got=%d %q", len(errs), p.Errors())
+	}
+
+	if errs[0].Error() != "1:9: unterminated string literal" {
+		t.Errorf("error wrong. got=%q", errs[0].Error())
+	}
+
+	var lexErr *lexer.Error
+	if !errors.As(errs[0], &lexErr) || lexErr.Kind != lexer.ErrUnterminatedString {
+		t.Errorf("errors.As failed or wrong kind. got=%v", lexErr)
+	}
+
+	if len(program.Statements) != 1 {
+		t.Errorf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+}
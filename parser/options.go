@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/naronA/monkey/ast"
+	"github.com/naronA/monkey/mtoken"
+)
+
+/*
+パーサーの拡張
+New にオプションを渡すと、そのパーサーだけに独自の前置・中置の構文解析関数や優先順位を登録できる
+パッケージ全体で共有している precedenses は書き換えないので、他のパーサーには影響しない
+
+構文解析関数は組み込みのものと同じ規約に従う
+呼ばれた時点で関数に関連付けられたトークンが CurToken にあり、式の最後のトークンが CurToken になるまで進めて返す
+*/
+
+// PrefixParseFn は前置の位置に現れたトークンから式を解析する
+type PrefixParseFn func(p *Parser) ast.Expression
+
+// InfixParseFn は左辺の式と、CurToken にある中置演算子から式を解析する
+type InfixParseFn func(p *Parser, left ast.Expression) ast.Expression
+
+// Option はパーサーの設定を変更する
+type Option func(p *Parser)
+
+// WithPrefix はトークンの前置構文解析関数を登録する. 組み込みの関数があれば置き換える
+func WithPrefix(tokenType mtoken.TokenType, fn PrefixParseFn) Option {
+	return func(p *Parser) {
+		p.registerPrefix(tokenType, func() ast.Expression { return fn(p) })
+	}
+}
+
+// WithInfix はトークンの中置構文解析関数とその優先順位を登録する. 組み込みの関数があれば置き換える
+func WithInfix(tokenType mtoken.TokenType, precedence int, fn InfixParseFn) Option {
+	return func(p *Parser) {
+		p.registerInfix(tokenType, func(left ast.Expression) ast.Expression { return fn(p, left) })
+		p.setPrecedence(tokenType, precedence)
+	}
+}
+
+// WithPrecedence はトークンの優先順位を変更する. 構文解析関数は変わらない
+func WithPrecedence(tokenType mtoken.TokenType, precedence int) Option {
+	return func(p *Parser) {
+		p.setPrecedence(tokenType, precedence)
+	}
+}
+
+func (p *Parser) setPrecedence(tokenType mtoken.TokenType, precedence int) {
+	if p.precedences == nil {
+		p.precedences = make(map[mtoken.TokenType]int)
+	}
+
+	p.precedences[tokenType] = precedence
+}
+
+// Precedence はこのパーサーでのトークンの優先順位を返す. 中置演算子でなければ LOWEST
+func (p *Parser) Precedence(tokenType mtoken.TokenType) int {
+	if prec, ok := p.precedences[tokenType]; ok {
+		return prec
+	}
+
+	if prec, ok := precedenses[tokenType]; ok {
+		return prec
+	}
+
+	return LOWEST
+}
+
+// CurToken は解析中のトークンを返す
+func (p *Parser) CurToken() mtoken.Token {
+	return p.curToken
+}
+
+// PeekToken は次のトークンを返す
+func (p *Parser) PeekToken() mtoken.Token {
+	return p.peekToken
+}
+
+// CurTokenIs は解析中のトークンの種類が t かどうかを返す
+func (p *Parser) CurTokenIs(t mtoken.TokenType) bool {
+	return p.curTokenIs(t)
+}
+
+// PeekTokenIs は次のトークンの種類が t かどうかを返す
+func (p *Parser) PeekTokenIs(t mtoken.TokenType) bool {
+	return p.peekTokenIs(t)
+}
+
+// NextToken はトークンを1つ進める
+func (p *Parser) NextToken() {
+	p.nextToken()
+}
+
+// ExpectPeek は次のトークンが t なら進めて true を返す. そうでなければエラーを記録して false を返す
+func (p *Parser) ExpectPeek(t mtoken.TokenType) bool {
+	return p.expectPeek(t)
+}
+
+// ParseExpression は CurToken から始まる式を、precedence より強く結びつく演算子までまとめて解析する
+func (p *Parser) ParseExpression(precedence int) ast.Expression {
+	return p.parseExpression(precedence)
+}
+
+// Errorf は tok の位置に構文エラーを記録する. 同じ文で既にエラーが起きていれば記録しない
+func (p *Parser) Errorf(tok mtoken.Token, format string, args ...interface{}) {
+	p.addError(ErrExtension, tok, nil, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/naronA/monkey/ast"
+	"github.com/naronA/monkey/lexer"
+	"github.com/naronA/monkey/mtoken"
+)
+
+// x in xs を所属判定の中置演算子として読む
+func parseInOperator(p *Parser, left ast.Expression) ast.Expression {
+	exp := &ast.InfixExpression{
+		Token:    p.CurToken(),
+		Operator: p.CurToken().Literal,
+		Left:     left,
+	}
+
+	precedence := p.Precedence(p.CurToken().Type)
+	p.NextToken()
+	exp.Right = p.ParseExpression(precedence)
+
+	return exp
+}
+
+// :name をシンボルとして文字列リテラルに読む
+func parseSymbol(p *Parser) ast.Expression {
+	if !p.ExpectPeek(mtoken.IDENT) {
+		return nil
+	}
+
+	return &ast.StringLiteral{Token: p.CurToken(), Value: p.CurToken().Literal}
+}
+
+func TestWithInfix(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x in xs", "(x in xs)"},
+		{"a + 1 in xs == true", "(((a + 1) in xs) == true)"},
+		{"!(x in [1, 2])", "(!(x in [1, 2]))"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input), WithInfix(mtoken.IN, EQUALS+1, parseInOperator))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	p := New(lexer.New(`let s = :monkey;`), WithPrefix(mtoken.COLON, parseSymbol))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+
+	lit, ok := stmt.Value.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.StringLiteral. got=%T", stmt.Value)
+	}
+
+	if lit.Value != "monkey" {
+		t.Errorf("lit.Value is not %q. got=%q", "monkey", lit.Value)
+	}
+}
+
+func TestWithPrecedenceIsPerParser(t *testing.T) {
+	input := "1 + 2 * 3"
+
+	custom := New(lexer.New(input), WithPrecedence(mtoken.PLUS, PRODUCT+1))
+	program := custom.ParseProgram()
+	checkParserErrors(t, custom)
+
+	if program.String() != "((1 + 2) * 3)" {
+		t.Errorf("custom parser: got=%q", program.String())
+	}
+
+	if custom.Precedence(mtoken.PLUS) != PRODUCT+1 {
+		t.Errorf("custom.Precedence(PLUS) wrong. got=%d", custom.Precedence(mtoken.PLUS))
+	}
+
+	// 他のパーサーと共有の表は変わらない
+	if precedenses[mtoken.PLUS] != SUM {
+		t.Errorf("precedenses[PLUS] was modified. got=%d", precedenses[mtoken.PLUS])
+	}
+
+	plain := New(lexer.New(input))
+	program = plain.ParseProgram()
+	checkParserErrors(t, plain)
+
+	if program.String() != "(1 + (2 * 3))" {
+		t.Errorf("default parser: got=%q", program.String())
+	}
+}
+
+func TestWithInfixDoesNotLeak(t *testing.T) {
+	New(lexer.New(""), WithInfix(mtoken.IN, EQUALS, parseInOperator))
+
+	p := New(lexer.New("x in xs"))
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected default parser to reject %q", "x in xs")
+	}
+
+	if p.Precedence(mtoken.IN) != LOWEST {
+		t.Errorf("p.Precedence(IN) wrong. got=%d", p.Precedence(mtoken.IN))
+	}
+}
+
+func TestErrorf(t *testing.T) {
+	symbol := func(p *Parser) ast.Expression {
+		if !p.PeekTokenIs(mtoken.IDENT) {
+			p.Errorf(p.PeekToken(), "symbol name must be an identifier, got %s", p.PeekToken().Type)
+			return nil
+		}
+
+		return parseSymbol(p)
+	}
+
+	p := New(lexer.New("let s = :1; let t = :ok;"), WithPrefix(mtoken.COLON, symbol))
+	program := p.ParseProgram()
+
+	errs := p.ParseErrors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %q", p.Errors())
+	}
+
+	if errs[0].Kind != ErrExtension {
+		t.Errorf("error kind wrong. expected=%s, got=%s", ErrExtension, errs[0].Kind)
+	}
+
+	expected := "1:10: symbol name must be an identifier, got INT"
+	if errs[0].Error() != expected {
+		t.Errorf("error wrong. expected=%q, got=%q", expected, errs[0].Error())
+	}
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	testLetStatement(t, program.Statements[1], "t")
+}
@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/naronA/monkey/ast"
 	"github.com/naronA/monkey/lexer"
@@ -10,62 +12,120 @@ import (
 )
 
 var precedenses = map[mtoken.TokenType]int{
-	mtoken.EQ:       EQUALS,
-	mtoken.NOTEQ:    EQUALS,
-	mtoken.LT:       LESSGREATER,
-	mtoken.GT:       LESSGREATER,
-	mtoken.PLUS:     SUM,
-	mtoken.MINUS:    SUM,
-	mtoken.SLASH:    PRODUCT,
-	mtoken.ASTERISK: PRODUCT,
+	mtoken.OR:        LOGICALOR,
+	mtoken.AND:       LOGICALAND,
+	mtoken.EQ:        EQUALS,
+	mtoken.NOTEQ:     EQUALS,
+	mtoken.LT:        LESSGREATER,
+	mtoken.GT:        LESSGREATER,
+	mtoken.LTE:       LESSGREATER,
+	mtoken.GTE:       LESSGREATER,
+	mtoken.PLUS:      SUM,
+	mtoken.MINUS:     SUM,
+	mtoken.PIPE:      SUM,
+	mtoken.CARET:     SUM,
+	mtoken.SLASH:     PRODUCT,
+	mtoken.ASTERISK:  PRODUCT,
+	mtoken.PERCENT:   PRODUCT,
+	mtoken.AMPERSAND: PRODUCT,
+	mtoken.LSHIFT:    PRODUCT,
+	mtoken.RSHIFT:    PRODUCT,
+	mtoken.POW:       POWER,
+	mtoken.LPAREN:    CALL,
+	mtoken.LBRACKET:  INDEX,
+	mtoken.DOT:       INDEX,
 }
 
 const (
 	_ int = iota
 	LOWEST
+	LOGICALOR   // ||
+	LOGICALAND  // &&
 	EQUALS      // ==
-	LESSGREATER // > または <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X または !X
+	LESSGREATER // >, <, >= または <=
+	SUM         // +, -, |, ^
+	PRODUCT     // *, /, %, &, <<, >> (ビット演算子の優先順位はGoと同じ)
+	PREFIX      // -X, !X または ~X
+	POWER       // X ** Y (右結合. -X ** Y は -(X ** Y) になる)
 	CALL        // myFunction(X)
+	INDEX       // array[index] または hash.field
 )
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string // errorsフィールドができた。単に文字列のスライスだ。
+	errors ErrorList
+
+	// エラーを報告してから次の文の区切りに同期するまでの間はtrue
+	// この間に起きたエラーは最初のエラーの連鎖なので報告しない
+	panicking bool
+
+	// 解析中のブロックの深さ
+	blockDepth int
+
+	// 解析中のループ本体の深さ. 関数リテラルに入ると0に戻る
+	loopDepth int
+
+	// ParseErrorsに取り込み済みの字句エラーの数
+	lexErrors int
 
 	curToken  mtoken.Token
 	peekToken mtoken.Token
 
 	prefixParseFns map[mtoken.TokenType]prefixParseFn
 	infixParseFns  map[mtoken.TokenType]infixParseFn
+
+	// オプションで変更した優先順位. ここにないトークンは precedenses を使う
+	precedences map[mtoken.TokenType]int
 }
 
-func New(l *lexer.Lexer) *Parser {
+func New(l *lexer.Lexer, opts ...Option) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: ErrorList{},
 	}
 	p.prefixParseFns = make(map[mtoken.TokenType]prefixParseFn)
 	p.registerPrefix(mtoken.IDENT, p.parseIdentifier)
 	p.registerPrefix(mtoken.INT, p.parseIntegerLiteral)
+	p.registerPrefix(mtoken.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(mtoken.STRING, p.parseStringLiteral)
 	p.registerPrefix(mtoken.BANNG, p.parsePrefixExpression)
 	p.registerPrefix(mtoken.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(mtoken.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(mtoken.TRUE, p.parseBoolean)
 	p.registerPrefix(mtoken.FALSE, p.parseBoolean)
 	p.registerPrefix(mtoken.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(mtoken.IF, p.parseIfExpression)
+	p.registerPrefix(mtoken.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(mtoken.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(mtoken.LBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[mtoken.TokenType]infixParseFn)
 	p.registerInfix(mtoken.PLUS, p.parseInfixExpression)
 	p.registerInfix(mtoken.MINUS, p.parseInfixExpression)
 	p.registerInfix(mtoken.SLASH, p.parseInfixExpression)
 	p.registerInfix(mtoken.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(mtoken.PERCENT, p.parseInfixExpression)
+	p.registerInfix(mtoken.POW, p.parseInfixExpression)
+	p.registerInfix(mtoken.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(mtoken.PIPE, p.parseInfixExpression)
+	p.registerInfix(mtoken.CARET, p.parseInfixExpression)
+	p.registerInfix(mtoken.LSHIFT, p.parseInfixExpression)
+	p.registerInfix(mtoken.RSHIFT, p.parseInfixExpression)
 	p.registerInfix(mtoken.EQ, p.parseInfixExpression)
 	p.registerInfix(mtoken.NOTEQ, p.parseInfixExpression)
 	p.registerInfix(mtoken.LT, p.parseInfixExpression)
 	p.registerInfix(mtoken.GT, p.parseInfixExpression)
+	p.registerInfix(mtoken.LTE, p.parseInfixExpression)
+	p.registerInfix(mtoken.GTE, p.parseInfixExpression)
+	p.registerInfix(mtoken.AND, p.parseLogicalExpression)
+	p.registerInfix(mtoken.OR, p.parseLogicalExpression)
+	p.registerInfix(mtoken.LPAREN, p.parseCallExpression)
+	p.registerInfix(mtoken.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(mtoken.DOT, p.parseFieldExpression)
+
+	for _, opt := range opts {
+		opt(p)
+	}
 
 	// 2つのトークンを読み込む. curTokenとpeekTokenの両方がセットされる
 	p.nextToken()
@@ -77,14 +137,69 @@ func New(l *lexer.Lexer) *Parser {
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
-	if !p.expectPeek(mtoken.LPAREN) {
+	expression.Condition, expression.Consequence = p.parseConditionalBlock()
+	if expression.Consequence == nil {
 		return nil
 	}
 
-	p.nextToken()
-	expression.Condition = p.parseExpression(LOWEST)
+	for p.peekTokenIs(mtoken.ELSE) {
+		p.nextToken()
+
+		// else if はネストさせずに ElseIfs に並べる
+		if p.peekTokenIs(mtoken.IF) {
+			p.nextToken()
+
+			clause := &ast.ElseIf{Token: p.curToken}
+			clause.Condition, clause.Consequence = p.parseConditionalBlock()
+			if clause.Consequence == nil {
+				return nil
+			}
+
+			expression.ElseIfs = append(expression.ElseIfs, clause)
+
+			continue
+		}
+
+		if !p.expectPeek(mtoken.LBRACE) {
+			return nil
+		}
+
+		expression.Alternative = p.parseBlockStatement()
+
+		break
+	}
+
+	return expression
+}
+
+// parseConditionalBlock は if の後ろの (条件) { ... } を読む. curTokenは「if」
+func (p *Parser) parseConditionalBlock() (ast.Expression, *ast.BlockStatement) {
+	if !p.expectPeek(mtoken.LPAREN) {
+		return nil, nil
+	}
+
+	condition := p.parseOperand(LOWEST)
 
 	if !p.expectPeek(mtoken.RPAREN) {
+		return nil, nil
+	}
+
+	if !p.expectPeek(mtoken.LBRACE) {
+		return nil, nil
+	}
+
+	return condition, p.parseBlockStatement()
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(mtoken.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
 		return nil
 	}
 
@@ -92,25 +207,59 @@ func (p *Parser) parseIfExpression() ast.Expression {
 		return nil
 	}
 
-	expression.Consequence = p.parseBlockStatement()
+	// 関数の本体から外側のループを break することはできない
+	loopDepth := p.loopDepth
+	p.loopDepth = 0
+	lit.Body = p.parseBlockStatement()
+	p.loopDepth = loopDepth
 
-	if p.peekTokenIs(mtoken.ELSE) {
+	return lit
+}
+
+func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	// 引数なし fn() {}
+	if p.peekTokenIs(mtoken.RPAREN) {
 		p.nextToken()
+		return identifiers
+	}
 
-		if !p.expectPeek(mtoken.LBRACE) {
+	if !p.expectPeek(mtoken.IDENT) {
+		return nil
+	}
+
+	identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+
+	for p.peekTokenIs(mtoken.COMMA) {
+		p.nextToken()
+
+		// 呼び出しの引数と同じく末尾の「,」を許す fn(a, b,) {}
+		if p.peekTokenIs(mtoken.RPAREN) {
+			break
+		}
+
+		if !p.expectPeek(mtoken.IDENT) {
 			return nil
 		}
 
-		expression.Alternative = p.parseBlockStatement()
+		identifiers = append(identifiers, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
 	}
 
-	return expression
+	if !p.expectPeek(mtoken.RPAREN) {
+		return nil
+	}
+
+	return identifiers
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.curTokenIs(mtoken.RBRACE) && !p.curTokenIs(mtoken.EOF) {
@@ -122,18 +271,28 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		p.nextToken()
 	}
 
+	// 閉じ括弧が来る前に入力が終わった
+	if p.curTokenIs(mtoken.EOF) {
+		p.unexpectedEOFError(p.curToken, mtoken.RBRACE)
+		return block
+	}
+
+	block.Rbrace = p.curToken.Pos
+
 	return block
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
-	p.nextToken()
+	exp := &ast.ParenExpression{Token: p.curToken}
 
-	exp := p.parseExpression(LOWEST)
+	exp.Expression = p.parseOperand(LOWEST)
 
 	if !p.expectPeek(mtoken.RPAREN) {
 		return nil
 	}
 
+	exp.Rparen = p.curToken.Pos
+
 	return exp
 }
 
@@ -149,21 +308,181 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecendece()
-	p.nextToken()
-	expression.Right = p.parseExpression(precedence)
+
+	// 右結合の演算子は、右辺に同じ優先順位の演算子を含められるように一つ低い優先順位で読む
+	if p.curTokenIs(mtoken.POW) {
+		precedence--
+	}
+
+	expression.Right = p.parseOperand(precedence)
 
 	return expression
 }
 
-func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expression := &ast.LogicalExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
+	precedence := p.curPrecendece()
+	expression.Right = p.parseOperand(precedence)
+
+	return expression
+}
+
+func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	exp := &ast.CallExpression{Token: p.curToken, Function: function}
+	exp.Arguments = p.parseExpressionList(mtoken.RPAREN)
+
+	if exp.Arguments == nil {
+		return nil
+	}
+
+	exp.Rparen = p.curToken.Pos
+
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(mtoken.RBRACKET)
+
+	if array.Elements == nil {
+		return nil
+	}
+
+	array.Rbracket = p.curToken.Pos
+
+	return array
+}
+
+/*
+式の位置にある「{」はハッシュリテラルとして読む
+ブロックは if や fn の後ろで parseBlockStatement が直接読むので、ここには来ない
+*/
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.peekTokenIs(mtoken.RBRACE) {
+		key := p.parseOperand(LOWEST)
+
+		if !p.expectPeek(mtoken.COLON) {
+			return nil
+		}
+
+		value := p.parseOperand(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		// 最後の組の後ろのカンマは許す
+		if !p.peekTokenIs(mtoken.RBRACE) && !p.expectPeek(mtoken.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(mtoken.RBRACE) {
+		return nil
+	}
+
+	hash.Rbrace = p.curToken.Pos
+
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	exp.Index = p.parseOperand(LOWEST)
+
+	if !p.expectPeek(mtoken.RBRACKET) {
+		return nil
+	}
+
+	exp.Rbracket = p.curToken.Pos
+
+	return exp
+}
+
+func (p *Parser) parseFieldExpression(left ast.Expression) ast.Expression {
+	exp := &ast.FieldExpression{Token: p.curToken, Left: left}
+
+	if !p.expectPeek(mtoken.IDENT) {
+		return nil
+	}
+
+	exp.Field = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	return exp
+}
+
+/*
+関数呼び出しの引数や配列の要素のような、カンマ区切りの式の並びをendまで読む
+最後の要素の後ろのカンマは許す (f(a, b,) や [1, 2, 3,])
+endが見つからなければnilを返す
+*/
+func (p *Parser) parseExpressionList(end mtoken.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	// 空の並び f() や []
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return list
+	}
+
+	list = append(list, p.parseOperand(LOWEST))
+
+	for p.peekTokenIs(mtoken.COMMA) {
+		p.nextToken()
+
+		if p.peekTokenIs(end) {
+			break
+		}
+
+		list = append(list, p.parseOperand(LOWEST))
+	}
+
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+// closingTokens は式を閉じるトークン. 式が来るべき所にこれがあれば式が抜けている
+var closingTokens = map[mtoken.TokenType]bool{
+	mtoken.RBRACE:    true,
+	mtoken.RPAREN:    true,
+	mtoken.RBRACKET:  true,
+	mtoken.SEMICOLON: true,
+	mtoken.EOF:       true,
+}
+
+/*
+parseOperand は次のトークンから始まる式を読む
+式が抜けていて閉じるトークンが続くときは、そのトークンを読み進めずにエラーにする
+1 + } の } を読み進めてしまうと、囲んでいるブロックを閉じられずに後ろの文が全てブロックに入ってしまう
+*/
+func (p *Parser) parseOperand(precedence int) ast.Expression {
+	if closingTokens[p.peekToken.Type] && p.prefixParseFns[p.peekToken.Type] == nil {
+		p.noPrefixParseFnError(p.peekToken)
+		return &ast.BadExpression{Token: p.peekToken}
 	}
 
 	p.nextToken()
 
-	expression.Right = p.parseExpression(PREFIX)
+	return p.parseExpression(precedence)
+}
+
+func (p *Parser) parsePrefixExpression() ast.Expression {
+	expression := &ast.PrefixExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+	}
+
+	expression.Right = p.parseOperand(PREFIX)
 
 	return expression
 }
@@ -185,21 +504,80 @@ func (p *Parser) parseIdentifier() ast.Expression {
 	}
 }
 
+// Errors はエラーを従来の文字列形式で返す
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, e := range p.errors {
+		msgs[i] = e.Error()
+	}
+
+	return msgs
+}
+
+// ParseErrors は構造化されたエラーを返す
+func (p *Parser) ParseErrors() []*ParseError {
+	return p.errors
+}
+
+// Err はエラーがなければ nil を、あれば ErrorList を返す
+func (p *Parser) Err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+
 	return p.errors
 }
 
 func (p *Parser) peekError(t mtoken.TokenType) {
+	// ILLEGALトークンは字句エラーとして報告済み
+	if p.peekTokenIs(mtoken.ILLEGAL) {
+		p.panicking = true
+		return
+	}
+
+	if p.peekTokenIs(mtoken.EOF) {
+		p.unexpectedEOFError(p.peekToken, t)
+		return
+	}
+
 	msg := fmt.Sprintf(
 		"expected next token to be %s, got %s instead",
 		t, p.peekToken.Type,
 	)
-	p.errors = append(p.errors, msg)
+	p.addError(ErrUnexpectedToken, p.peekToken, []mtoken.TokenType{t}, msg)
+}
+
+func (p *Parser) addError(kind ErrorKind, actual mtoken.Token, expected []mtoken.TokenType, msg string) {
+	if p.panicking {
+		return
+	}
+
+	p.panicking = true
+	p.errors = append(p.errors, &ParseError{
+		Kind:     kind,
+		Pos:      actual.Pos,
+		Expected: expected,
+		Actual:   actual,
+		Msg:      msg,
+	})
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// 字句エラーは字句解析器が見つけた時点でそのまま記録する
+	for _, e := range p.l.Errors()[p.lexErrors:] {
+		p.errors = append(p.errors, &ParseError{
+			Kind:   ErrLexical,
+			Pos:    e.Pos,
+			Actual: p.peekToken,
+			Msg:    e.Msg,
+			Err:    e,
+		})
+	}
+
+	p.lexErrors = len(p.l.Errors())
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
@@ -219,14 +597,95 @@ func (p *Parser) ParseProgram() *ast.Program {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	start := p.curToken
+
+	var stmt ast.Statement
+
 	// このswitch分岐がどんどん増えていく
+	// 型付きの nil を ast.Statement に入れないように、nil でないときだけ代入する
 	switch p.curToken.Type {
 	case mtoken.LET:
-		return p.parseLetStatement()
+		if s := p.parseLetStatement(); s != nil {
+			stmt = s
+		}
 	case mtoken.RETURN:
-		return p.parseReturnStatement()
+		if s := p.parseReturnStatement(); s != nil {
+			stmt = s
+		}
+	case mtoken.WHILE:
+		if s := p.parseWhileStatement(); s != nil {
+			stmt = s
+		}
+	case mtoken.FOR:
+		if s := p.parseForStatement(); s != nil {
+			stmt = s
+		}
+	case mtoken.BREAK:
+		stmt = p.parseBreakStatement()
+	case mtoken.CONTINUE:
+		stmt = p.parseContinueStatement()
 	default:
-		return p.parseExpressionStatement()
+		stmt = p.parseExpressionStatement()
+	}
+
+	// 文の途中でエラーが起きたら、次の文の区切りまで読み飛ばして復帰する
+	if p.panicking {
+		p.synchronize()
+		p.panicking = false
+
+		if stmt == nil {
+			return &ast.BadStatement{Token: start}
+		}
+	}
+
+	return stmt
+}
+
+// 文の先頭または終わりを表すトークン. エラーからの復帰時にここまで読み飛ばす
+var syncTokens = map[mtoken.TokenType]bool{
+	mtoken.LET:      true,
+	mtoken.RETURN:   true,
+	mtoken.WHILE:    true,
+	mtoken.FOR:      true,
+	mtoken.BREAK:    true,
+	mtoken.CONTINUE: true,
+	mtoken.RBRACE:   true,
+	mtoken.EOF:      true,
+}
+
+/*
+パニックモードのエラー回復
+curTokenが「;」になるか、peekTokenが次の文の始まり (またはブロックの終わり) になるまで進める
+ParseProgramやparseBlockStatementのループは続けてnextTokenを呼ぶので、次の文から解析を再開できる
+読み飛ばす途中で開いた { } の中は同期点にしない
+*/
+func (p *Parser) synchronize() {
+	nesting := 0
+
+	for !p.curTokenIs(mtoken.EOF) {
+		switch {
+		case p.curTokenIs(mtoken.LBRACE):
+			nesting++
+		case p.curTokenIs(mtoken.RBRACE) && nesting > 0:
+			nesting--
+		}
+
+		if nesting == 0 {
+			if p.curTokenIs(mtoken.SEMICOLON) {
+				return
+			}
+
+			// トップレベルの } は閉じるブロックがないので同期点にしない
+			if syncTokens[p.peekToken.Type] && (!p.peekTokenIs(mtoken.RBRACE) || p.blockDepth > 0) {
+				return
+			}
+		}
+
+		if p.peekTokenIs(mtoken.EOF) {
+			return
+		}
+
+		p.nextToken()
 	}
 }
 
@@ -246,8 +705,107 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		return nil
 	}
 
-	// セミコロンに遭遇するまで式を読み飛ばしてしまっている.
-	for !p.curTokenIs(mtoken.SEMICOLON) {
+	stmt.Value = p.parseOperand(LOWEST)
+
+	// セミコロンは省略可能
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() *ast.WhileStatement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(mtoken.LPAREN) {
+		return nil
+	}
+
+	stmt.Condition = p.parseOperand(LOWEST)
+
+	if !p.expectPeek(mtoken.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(mtoken.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(mtoken.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(mtoken.IDENT) {
+		return nil
+	}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(mtoken.IN) {
+		return nil
+	}
+
+	stmt.Iterable = p.parseOperand(LOWEST)
+
+	if !p.expectPeek(mtoken.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(mtoken.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() *ast.BreakStatement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.outsideLoopError()
+	}
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.loopDepth == 0 {
+		p.outsideLoopError()
+	}
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -279,10 +837,21 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 		Token: p.curToken,
 	}
 
+	// 値のない return; (または return } ) を許容する
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+		return stmt
+	}
+
+	if p.peekTokenIs(mtoken.RBRACE) || p.peekTokenIs(mtoken.EOF) {
+		return stmt
+	}
+
 	p.nextToken()
 
-	// セミコロンに遭遇するまで指揮を読み飛ばしている
-	for !p.curTokenIs(mtoken.SEMICOLON) {
+	stmt.ReturnValue = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -297,10 +866,59 @@ func (p *Parser) registerInfix(tokenType mtoken.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// 代入文の演算子
+var assignOperators = map[mtoken.TokenType]bool{
+	mtoken.ASSIGN:          true,
+	mtoken.PLUS_ASSIGN:     true,
+	mtoken.MINUS_ASSIGN:    true,
+	mtoken.ASTERISK_ASSIGN: true,
+	mtoken.SLASH_ASSIGN:    true,
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
 
+	// 式の後に代入演算子が続いたら、その式を左辺とする代入文として読む
+	if assignOperators[p.peekToken.Type] && !p.panicking {
+		return p.parseAssignStatement(stmt.Token, stmt.Expression)
+	}
+
+	if p.peekTokenIs(mtoken.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseAssignStatement(start mtoken.Token, target ast.Expression) *ast.AssignStatement {
+	p.nextToken()
+
+	stmt := &ast.AssignStatement{
+		Token:    p.curToken,
+		Target:   target,
+		Operator: p.curToken.Literal,
+	}
+
+	// (x) = 1 のように括弧でくくった代入先も受け付ける
+	inner := target
+	for {
+		paren, ok := inner.(*ast.ParenExpression)
+		if !ok {
+			break
+		}
+
+		inner = paren.Expression
+	}
+
+	switch inner.(type) {
+	case *ast.Identifier, *ast.IndexExpression, *ast.FieldExpression:
+	default:
+		p.invalidAssignmentError(start, target)
+	}
+
+	stmt.Value = p.parseOperand(LOWEST)
+
 	if p.peekTokenIs(mtoken.SEMICOLON) {
 		p.nextToken()
 	}
@@ -309,13 +927,25 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	start := p.curToken
+
+	// return は文なので式の位置には書けない
+	if p.curTokenIs(mtoken.RETURN) {
+		p.returnInExpressionError()
+		return &ast.BadExpression{Token: start}
+	}
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
-		return nil
+		p.noPrefixParseFnError(p.curToken)
+		return &ast.BadExpression{Token: start}
 	}
 
+	// 構文解析関数が失敗したら (nilを返したら) BadExpressionで置き換え、木にnilを残さない
 	leftExp := prefix()
+	if leftExp == nil {
+		return &ast.BadExpression{Token: start}
+	}
 
 	for !p.peekTokenIs(mtoken.SEMICOLON) && precedence < p.peekPrecendece() {
 		infix := p.infixParseFns[p.peekToken.Type]
@@ -326,6 +956,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		p.nextToken()
 
 		leftExp = infix(leftExp)
+		if leftExp == nil {
+			return &ast.BadExpression{Token: start}
+		}
 	}
 
 	return leftExp
@@ -334,11 +967,42 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	// 区切りの「_」は字句解析器が検査済み. 0 で始まる10進数 (017) も字句解析器がエラーにしている
+	literal := strings.ReplaceAll(p.curToken.Literal, "_", "")
+	base := 10
+
+	if len(literal) > 2 && literal[0] == '0' {
+		switch literal[1] {
+		case 'x', 'X':
+			base = 16
+		case 'o', 'O':
+			base = 8
+		case 'b', 'B':
+			base = 2
+		}
+	}
+
+	if base != 10 {
+		literal = literal[2:]
+	}
+
+	value, err := strconv.ParseInt(literal, base, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.numberError(err, "integer")
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{Token: p.curToken}
 
+	value, err := strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
+	if err != nil {
+		p.numberError(err, "float")
 		return nil
 	}
 
@@ -347,28 +1011,66 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) numberError(err error, kind string) {
+	if errors.Is(err, strconv.ErrRange) {
+		msg := fmt.Sprintf("%s literal %s out of range", kind, p.curToken.Literal)
+		p.addError(ErrNumberOutOfRange, p.curToken, nil, msg)
+
+		return
+	}
+
+	msg := fmt.Sprintf("could not parse %q as %s", p.curToken.Literal, kind)
+	p.addError(ErrInvalidNumber, p.curToken, nil, msg)
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 type (
 	prefixParseFn func() ast.Expression
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
-func (p *Parser) noPrefixParseFnError(t mtoken.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) unexpectedEOFError(eof mtoken.Token, t mtoken.TokenType) {
+	msg := fmt.Sprintf("unexpected end of input, expected %s", t)
+	p.addError(ErrUnexpectedEOF, eof, []mtoken.TokenType{t}, msg)
 }
 
-func (p *Parser) peekPrecendece() int {
-	if p, ok := precedenses[p.peekToken.Type]; ok {
-		return p
+func (p *Parser) noPrefixParseFnError(tok mtoken.Token) {
+	if tok.Type == mtoken.ILLEGAL {
+		p.panicking = true
+		return
+	}
+
+	if tok.Type == mtoken.EOF {
+		p.addError(ErrUnexpectedEOF, tok, nil, "unexpected end of input")
+		return
 	}
 
-	return LOWEST
+	msg := fmt.Sprintf("no prefix parse function for %s found", tok.Type)
+	p.addError(ErrNoPrefixParseFn, tok, nil, msg)
 }
 
-func (p *Parser) curPrecendece() int {
-	if p, ok := precedenses[p.curToken.Type]; ok {
-		return p
-	}
+func (p *Parser) returnInExpressionError() {
+	msg := "return statement not allowed in expression position"
+	p.addError(ErrReturnInExpression, p.curToken, nil, msg)
+}
 
-	return LOWEST
+func (p *Parser) outsideLoopError() {
+	msg := fmt.Sprintf("%s is not in a loop", p.curToken.Literal)
+	p.addError(ErrOutsideLoop, p.curToken, nil, msg)
+}
+
+func (p *Parser) invalidAssignmentError(start mtoken.Token, target ast.Expression) {
+	msg := fmt.Sprintf("cannot assign to %s", target)
+	p.addError(ErrInvalidAssignment, start, nil, msg)
+}
+
+func (p *Parser) peekPrecendece() int {
+	return p.Precedence(p.peekToken.Type)
+}
+
+func (p *Parser) curPrecendece() int {
+	return p.Precedence(p.curToken.Type)
 }
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/naronA/monkey/ast"
 	"github.com/naronA/monkey/lexer"
@@ -18,7 +21,7 @@ func testBooleanLiteral(t *testing.T, il ast.Expression, value bool) bool {
 		t.Errorf("Boolean value not %t. got=%t", value, integ.Value)
 		return false
 	}
-	return false
+	return true
 }
 
 func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
@@ -32,7 +35,7 @@ func testIntegerLiteral(t *testing.T, il ast.Expression, value int64) bool {
 		t.Errorf("integ.Value not %d. got=%d", value, integ.Value)
 		return false
 	}
-	return false
+	return true
 }
 
 func TestOperatorPrecedencParsing(t *testing.T) {
@@ -114,6 +117,162 @@ func TestOperatorPrecedencParsing(t *testing.T) {
 			"!(true == true)",
 			"(!(true == true))",
 		},
+		{
+			"a + add(b * c) + d",
+			"((a + add((b * c))) + d)",
+		},
+		{
+			"add(a, b, 1, 2 * 3, 4 + 5, add(6, 7 * 8))",
+			"add(a, b, 1, (2 * 3), (4 + 5), add(6, (7 * 8)))",
+		},
+		{
+			"add(a + b + c * d / f + g)",
+			"add((((a + b) + ((c * d) / f)) + g))",
+		},
+		{
+			"-f(x)",
+			"(-f(x))",
+		},
+		{
+			"f(1)(2)",
+			"f(1)(2)",
+		},
+		{
+			"f(1)(2)(a * b)",
+			"f(1)(2)((a * b))",
+		},
+		{
+			"fn(x) { x }(5)",
+			"fn(x) { x }(5)",
+		},
+		{
+			"add()",
+			"add()",
+		},
+		{
+			"a <= b == b >= a",
+			"((a <= b) == (b >= a))",
+		},
+		{
+			"x >= 0 && x < n",
+			"((x >= 0) && (x < n))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a || b || c",
+			"((a || b) || c)",
+		},
+		{
+			"a == b && !c",
+			"((a == b) && (!c))",
+		},
+		{
+			"(a || b) && c",
+			"((a || b) && c)",
+		},
+		{
+			"f(a && b, c || d)",
+			"f((a && b), (c || d))",
+		},
+		{
+			"a % b * c",
+			"((a % b) * c)",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** -1",
+			"(2 ** (-1))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"-a ** b * c",
+			"((-(a ** b)) * c)",
+		},
+		{
+			"f(x) ** 2",
+			"(f(x) ** 2)",
+		},
+		{
+			"a | b ^ c & d",
+			"((a | b) ^ (c & d))",
+		},
+		{
+			"a & b | c",
+			"((a & b) | c)",
+		},
+		{
+			"a << 1 + b >> 2",
+			"((a << 1) + (b >> 2))",
+		},
+		{
+			"a + b << c",
+			"(a + (b << c))",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"a | b < c && d",
+			"(((a | b) < c) && d)",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"~a ** 2",
+			"(~(a ** 2))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"m[0][1]",
+			"((m[0])[1])",
+		},
+		{
+			"-a[0]",
+			"(-(a[0]))",
+		},
+		{
+			"f(x)[0]",
+			"(f(x)[0])",
+		},
+		{
+			"fs[0](x)",
+			"(fs[0])(x)",
+		},
+		{
+			"a[0] ** 2",
+			"((a[0]) ** 2)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -139,6 +298,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-15;", "-", 15},
 		{"!true;", "!", true},
 		{"!false", "!", false},
+		{"~5;", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -173,7 +333,57 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		}
 	}
 }
+
 func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+		expectedString     string
+	}{
+		{"let x = 5;", "x", 5, "let x = 5;"},
+		{"let y = true;", "y", true, "let y = true;"},
+		{"let foobar = y;", "foobar", "y", "let foobar = y;"},
+		{"let z = 838383", "z", 838383, "let z = 838383;"},
+		{"let x = 5 * y;", "x", nil, "let x = (5 * y);"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program == nil {
+			t.Fatalf("ParseProgram() returned nil")
+		}
+
+		if len(program.Statements) != 1 {
+			t.Fatalf(
+				"program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements),
+			)
+		}
+
+		stmt := program.Statements[0]
+		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
+			return
+		}
+
+		val := stmt.(*ast.LetStatement).Value
+		if val == nil {
+			t.Fatalf("stmt.Value is nil")
+		}
+		if tt.expectedValue != nil && !testLiteralExpression(t, val, tt.expectedValue) {
+			return
+		}
+
+		if stmt.String() != tt.expectedString {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.expectedString, stmt.String())
+		}
+	}
+}
+
+func TestLetStatementsMultiple(t *testing.T) {
 	input := `
 let x = 5;
 let y = 10;
@@ -183,9 +393,6 @@ let foobar = 838383;
 	p := New(l)
 	program := p.ParseProgram()
 	checkParserErrors(t, p)
-	if program == nil {
-		t.Fatalf("ParseProgram() returned nil")
-	}
 
 	if len(program.Statements) != 3 {
 		t.Fatalf(
@@ -196,10 +403,11 @@ let foobar = 838383;
 
 	tests := []struct {
 		expectedIdentifier string
+		expectedValue      int64
 	}{
-		{"x"},
-		{"y"},
-		{"foobar"},
+		{"x", 5},
+		{"y", 10},
+		{"foobar", 838383},
 	}
 
 	for i, tt := range tests {
@@ -207,6 +415,9 @@ let foobar = 838383;
 		if !testLetStatement(t, stmt, tt.expectedIdentifier) {
 			return
 		}
+		if !testIntegerLiteral(t, stmt.(*ast.LetStatement).Value, tt.expectedValue) {
+			return
+		}
 	}
 }
 
@@ -255,27 +466,34 @@ func checkParserErrors(t *testing.T, p *Parser) {
 }
 
 func TestReturnStatements(t *testing.T) {
-	input := `
-return 5;
-return 10;
-return 993322;
-`
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	if len(program.Statements) != 3 {
-		t.Fatalf(
-			"program.Statements does not contain 3 statements. got=%d",
-			len(program.Statements),
-		)
+	tests := []struct {
+		input          string
+		expectedValue  interface{}
+		expectedString string
+	}{
+		{"return 5;", 5, "return 5;"},
+		{"return true;", true, "return true;"},
+		{"return foobar;", "foobar", "return foobar;"},
+		{"return 993322", 993322, "return 993322;"},
+		{"return x + y;", nil, "return (x + y);"},
 	}
-	for _, stmt := range program.Statements {
-		returnStmt, ok := stmt.(*ast.ReturnStatement)
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf(
+				"program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements),
+			)
+		}
+
+		returnStmt, ok := program.Statements[0].(*ast.ReturnStatement)
 		if !ok {
-			t.Errorf("stmt not *ast.returnStatement. got=%T", stmt)
-			continue
+			t.Fatalf("stmt not *ast.ReturnStatement. got=%T", program.Statements[0])
 		}
 		if returnStmt.TokenLiteral() != "return" {
 			t.Errorf(
@@ -283,6 +501,79 @@ return 993322;
 				returnStmt.TokenLiteral(),
 			)
 		}
+		if returnStmt.ReturnValue == nil {
+			t.Fatalf("returnStmt.ReturnValue is nil")
+		}
+		if tt.expectedValue != nil && !testLiteralExpression(t, returnStmt.ReturnValue, tt.expectedValue) {
+			return
+		}
+		if returnStmt.String() != tt.expectedString {
+			t.Errorf("returnStmt.String() wrong. expected=%q, got=%q", tt.expectedString, returnStmt.String())
+		}
+	}
+}
+
+func TestBareReturnStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedStatements int
+	}{
+		{"return;", 1},
+		{"return", 1},
+		{"return; 5", 2},
+		{"if (x) { return }", 1},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != tt.expectedStatements {
+			t.Fatalf(
+				"program.Statements does not contain %d statements. got=%d",
+				tt.expectedStatements,
+				len(program.Statements),
+			)
+		}
+
+		var returnStmt *ast.ReturnStatement
+		switch stmt := program.Statements[0].(type) {
+		case *ast.ReturnStatement:
+			returnStmt = stmt
+		case *ast.ExpressionStatement:
+			returnStmt = stmt.Expression.(*ast.IfExpression).Consequence.Statements[0].(*ast.ReturnStatement)
+		}
+
+		if returnStmt.ReturnValue != nil {
+			t.Errorf("returnStmt.ReturnValue not nil. got=%s", returnStmt.ReturnValue)
+		}
+		if returnStmt.String() != "return;" {
+			t.Errorf("returnStmt.String() wrong. got=%q", returnStmt.String())
+		}
+	}
+}
+
+func TestReturnInExpressionPosition(t *testing.T) {
+	tests := []string{
+		"let x = return 5;",
+		"1 + return 2;",
+		"if (return) { 1 }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", input)
+		}
+		if !strings.HasSuffix(errors[0], ": return statement not allowed in expression position") {
+			t.Errorf("wrong error for %q. got=%q", input, errors[0])
+		}
 	}
 }
 
@@ -423,6 +714,118 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestNumberLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"0;", int64(0)},
+		{"1_000_000", int64(1000000)},
+		{"0x1F", int64(31)},
+		{"0o17", int64(15)},
+		{"0_0.5", 0.5},
+		{"0b1010", int64(10)},
+		{"9223372036854775807", int64(9223372036854775807)},
+		{"1.5", 1.5},
+		{"2.5E-3", 0.0025},
+		{"1e10", 1e10},
+		{"1_0.5", 10.5},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			testIntegerLiteral(t, stmt.Expression, expected)
+		case float64:
+			literal, ok := stmt.Expression.(*ast.FloatLiteral)
+			if !ok {
+				t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+			}
+			if literal.Value != expected {
+				t.Errorf("literal.Value not %g. got=%g", expected, literal.Value)
+			}
+		}
+
+		if stmt.String() != tt.input && stmt.String()+";" != tt.input {
+			t.Errorf("stmt.String() wrong. expected=%q, got=%q", tt.input, stmt.String())
+		}
+	}
+}
+
+func TestNumberOutOfRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 9223372036854775808;", "1:9: integer literal 9223372036854775808 out of range"},
+		{"\n  0x1_0000_0000_0000_0000", "2:3: integer literal 0x1_0000_0000_0000_0000 out of range"},
+		{"1.5e400", "1:1: float literal 1.5e400 out of range"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedValue  string
+		expectedString string
+	}{
+		{`"hello world";`, "hello world", `"hello world"`},
+		{`"こんにちは"`, "こんにちは", `"こんにちは"`},
+		{`"a\n\t\"b\"\\"`, "a\n\t\"b\"\\", `"a\n\t\"b\"\\"`},
+		{`"\u{7}"`, "\a", `"\u{7}"`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.StringLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expectedValue {
+			t.Errorf("literal.Value not %q. got=%q", tt.expectedValue, literal.Value)
+		}
+
+		if literal.String() != tt.expectedString {
+			t.Errorf("literal.String() not %q. got=%q", tt.expectedString, literal.String())
+		}
+
+		// String() の出力を再度構文解析しても同じ値になる
+		p2 := New(lexer.New(literal.String()))
+		reparsed := p2.ParseProgram()
+		checkParserErrors(t, p2)
+		if v := reparsed.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral).Value; v != tt.expectedValue {
+			t.Errorf("round trip wrong. expected=%q, got=%q", tt.expectedValue, v)
+		}
+	}
+}
+
 func TestParsingInfixExpressions(t *testing.T) {
 	infixTests := []struct {
 		input      string
@@ -438,6 +841,15 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 	}
 	for _, tt := range infixTests {
 		l := lexer.New(tt.input)
@@ -472,26 +884,64 @@ func TestParsingInfixExpressions(t *testing.T) {
 	}
 }
 
-func TestIfExpression(t *testing.T) {
-	input := `if (x < y) { x }`
-
-	l := lexer.New(input)
-	p := New(l)
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
-
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+func TestLogicalExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		left     interface{}
+		operator string
+		right    interface{}
+	}{
+		{"true && false", true, "&&", false},
+		{"a || b;", "a", "||", "b"},
+		{"1 && 2", 1, "&&", 2},
 	}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
-	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
 
-	exp, ok := stmt.Expression.(*ast.IfExpression)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.LogicalExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.LogicalExpression. got=%T", stmt.Expression)
+		}
+
+		if !testLiteralExpression(t, exp.Left, tt.left) {
+			return
+		}
+
+		if exp.Operator != tt.operator {
+			t.Fatalf("exp.Operator is not '%s'. got=%s", tt.operator, exp.Operator)
+		}
+
+		if !testLiteralExpression(t, exp.Right, tt.right) {
+			return
+		}
+	}
+}
+
+func TestIfExpression(t *testing.T) {
+	input := `if (x < y) { x }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
 	}
 
 	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
@@ -516,67 +966,126 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
-func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
+func TestIfElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else if (x == 0) { 0 } else { z }`
 
-	opExp, ok := exp.(*ast.InfixExpression)
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
 	if !ok {
-		t.Errorf("exp is not ast.OperatorExpression. got=%T(%s)", exp, exp)
-		return false
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
 	}
 
-	if !testLiteralExpression(t, opExp.Left, left) {
-		return false
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
 	}
 
-	if opExp.Operator != operator {
-		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
-		return false
+	// else if はネストせずに並ぶ
+	if len(exp.ElseIfs) != 2 {
+		t.Fatalf("exp.ElseIfs does not contain 2 clauses. got=%d", len(exp.ElseIfs))
 	}
 
-	if !testLiteralExpression(t, opExp.Right, right) {
-		return false
+	tests := []struct {
+		left        interface{}
+		operator    string
+		right       interface{}
+		consequence interface{}
+	}{
+		{"x", ">", "y", "y"},
+		{"x", "==", 0, 0},
 	}
 
-	return true
-}
+	for i, tt := range tests {
+		clause := exp.ElseIfs[i]
 
-func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
-	switch v := expected.(type) {
-	case int:
-		return testIntegerLiteral(t, exp, int64(v))
-	case int64:
-		return testIntegerLiteral(t, exp, v)
-	case string:
-		return testIdentifier(t, exp, v)
-	case bool:
-		return testBooleanLiteral(t, exp, v)
+		if clause.TokenLiteral() != "if" {
+			t.Errorf("clause.TokenLiteral not 'if'. got=%q", clause.TokenLiteral())
+		}
+
+		if !testInfixExpression(t, clause.Condition, tt.left, tt.operator, tt.right) {
+			return
+		}
+
+		if len(clause.Consequence.Statements) != 1 {
+			t.Fatalf("clause.Consequence does not contain 1 statements. got=%d", len(clause.Consequence.Statements))
+		}
+
+		consequence := clause.Consequence.Statements[0].(*ast.ExpressionStatement)
+		if !testLiteralExpression(t, consequence.Expression, tt.consequence) {
+			return
+		}
+	}
+
+	if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative does not contain 1 statements. got=%+v", exp.Alternative)
+	}
+
+	alternative := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	testIdentifier(t, alternative.Expression, "z")
+
+	expected := "if(x < y) xelse if(x > y) yelse if(x == 0) 0else z"
+	if exp.String() != expected {
+		t.Errorf("exp.String() wrong. expected=%q, got=%q", expected, exp.String())
 	}
-	t.Errorf("type of exp not handled. got=%T", exp)
-	return false
 }
 
-func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
-	ident, ok := exp.(*ast.Identifier)
-	if !ok {
-		t.Errorf("exp not *ast.Identifier. got=%T", exp)
-		return false
+func TestIfElseIfWithoutElse(t *testing.T) {
+	l := lexer.New(`if (a) { 1 } else if (b) { 2 }; c`)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
 	}
 
-	if ident.Value != value {
-		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
-		return false
+	exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if len(exp.ElseIfs) != 1 {
+		t.Fatalf("exp.ElseIfs does not contain 1 clauses. got=%d", len(exp.ElseIfs))
 	}
 
-	if ident.TokenLiteral() != value {
-		t.Errorf("ident.TokenLiteral not %s. got=%s", value, ident.TokenLiteral())
-		return false
+	testIdentifier(t, exp.ElseIfs[0].Condition, "b")
+
+	if exp.Alternative != nil {
+		t.Errorf("exp.Alternative was not nil. got=%+v", exp.Alternative)
 	}
+}
 
-	return true
+func TestIfElseIfErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (a) { 1 } else if b { 2 }", "1:22: expected next token to be (, got IDENT instead"},
+		{"if (a) { 1 } else if (b) 2", "1:26: expected next token to be {, got INT instead"},
+		{"if (a) { 1 } else if", "1:21: unexpected end of input, expected ("},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
 }
 
-func TestIfElseExpression(t *testing.T) {
-	input := `if (x < y) { x } else { y }`
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue }`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -584,52 +1093,1152 @@ func TestIfElseExpression(t *testing.T) {
 	checkParserErrors(t, p)
 
 	if len(program.Statements) != 1 {
-		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
-			1, len(program.Statements))
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
 	}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
 	if !ok {
-		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
-			program.Statements[0])
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
 	}
 
-	exp, ok := stmt.Expression.(*ast.IfExpression)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	if !testInfixExpression(t, stmt.Condition, "x", "<", 10) {
+		return
 	}
 
-	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
-		return
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("stmt.Body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
 	}
 
-	if len(exp.Consequence.Statements) != 1 {
-		t.Errorf("consequence is not 1 statements. got=%d\n",
-			len(exp.Consequence.Statements))
+	ifExp := stmt.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExp.Consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("consequence is not ast.BreakStatement. got=%T", ifExp.Consequence.Statements[0])
 	}
 
-	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("stmt.Body.Statements[1] is not ast.ContinueStatement. got=%T", stmt.Body.Statements[1])
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	input := `for (x in [1, 2, 3]) { let y = x * 2; }; z`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ForStatement)
 	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Consequence.Statements[0])
+		t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T", program.Statements[0])
 	}
 
-	if !testIdentifier(t, consequence.Expression, "x") {
+	if !testIdentifier(t, stmt.Variable, "x") {
 		return
 	}
 
-	if len(exp.Alternative.Statements) != 1 {
-		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
-			len(exp.Alternative.Statements))
+	if _, ok := stmt.Iterable.(*ast.ArrayLiteral); !ok {
+		t.Errorf("stmt.Iterable is not ast.ArrayLiteral. got=%T", stmt.Iterable)
 	}
 
-	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if len(stmt.Body.Statements) != 1 {
+		t.Fatalf("stmt.Body does not contain 1 statements. got=%d", len(stmt.Body.Statements))
+	}
+
+	testLetStatement(t, stmt.Body.Statements[0], "y")
+
+	expected := "for(x in [1, 2, 3]) let y = (x * 2);"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. expected=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestBreakContinueOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"break;", []string{"1:1: break is not in a loop"}},
+		{"continue", []string{"1:1: continue is not in a loop"}},
+		{"if (x) { break; }", []string{"1:10: break is not in a loop"}},
+		{"while (x) { let f = fn() { break; }; }", []string{"1:28: break is not in a loop"}},
+		{"while (x) { break; }; continue;", []string{"1:23: continue is not in a loop"}},
+		{"for (x in xs) { while (y) { continue; } break; }", nil},
+		{"while (x) { fn() { while (y) { break; } }; continue; }", nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("%q: wrong number of errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while x { }", "1:7: expected next token to be (, got IDENT instead"},
+		{"while (x) y", "1:11: expected next token to be {, got IDENT instead"},
+		{"for (x of xs) { }", "1:8: expected next token to be IN, got IDENT instead"},
+		{"for (1 in xs) { }", "1:6: expected next token to be IDENT, got INT instead"},
+		{"for (x in xs { }", "1:14: expected next token to be ), got { instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestAssignStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		operator string
+		expected string
+	}{
+		{"x = 5;", "=", "x = 5;"},
+		{"x += y * 2", "+=", "x += (y * 2);"},
+		{"x -= 1;", "-=", "x -= 1;"},
+		{"x *= 3;", "*=", "x *= 3;"},
+		{"x /= 4;", "/=", "x /= 4;"},
+		{"a[i + 1] = 0;", "=", "(a[(i + 1)]) = 0;"},
+		{"h.name = \"monkey\";", "=", "(h.name) = \"monkey\";"},
+		{"h.list[0].count += 1", "+=", "(((h.list)[0]).count) += 1;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.AssignStatement)
+		if !ok {
+			t.Fatalf("%q: program.Statements[0] is not ast.AssignStatement. got=%T", tt.input, program.Statements[0])
+		}
+
+		if stmt.Operator != tt.operator {
+			t.Errorf("%q: stmt.Operator is not %q. got=%q", tt.input, tt.operator, stmt.Operator)
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("%q: stmt.String() wrong. expected=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestAssignStatementTargets(t *testing.T) {
+	input := `x = 1; a[0] = 2; h.key = 3;`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	x := program.Statements[0].(*ast.AssignStatement)
+	if !testIdentifier(t, x.Target, "x") || !testIntegerLiteral(t, x.Value, 1) {
+		return
+	}
+
+	index, ok := program.Statements[1].(*ast.AssignStatement).Target.(*ast.IndexExpression)
 	if !ok {
-		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
-			exp.Alternative.Statements[0])
+		t.Fatalf("target is not ast.IndexExpression. got=%T", program.Statements[1].(*ast.AssignStatement).Target)
+	}
+	if !testIdentifier(t, index.Left, "a") || !testIntegerLiteral(t, index.Index, 0) {
+		return
 	}
 
-	if !testIdentifier(t, alternative.Expression, "y") {
+	field, ok := program.Statements[2].(*ast.AssignStatement).Target.(*ast.FieldExpression)
+	if !ok {
+		t.Fatalf("target is not ast.FieldExpression. got=%T", program.Statements[2].(*ast.AssignStatement).Target)
+	}
+	if !testIdentifier(t, field.Left, "h") || !testIdentifier(t, field.Field, "key") {
 		return
 	}
 }
+
+func TestFieldExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"h.key", "(h.key)"},
+		{"a.b.c", "((a.b).c)"},
+		{"h.f(1)", "(h.f)(1)"},
+		{"-h.x * 2", "((-(h.x)) * 2)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestInvalidAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 = 2;", []string{"1:1: cannot assign to 1"}},
+		{"f() = 1; x = 2;", []string{"1:1: cannot assign to f()"}},
+		{"a + b += 1", []string{"1:1: cannot assign to (a + b)"}},
+		{"(a + b) = 1", []string{"1:1: cannot assign to (a + b)"}},
+		{"let x = 1; \"s\" = x", []string{"1:12: cannot assign to \"s\""}},
+		{"h.1 = 2", []string{"1:3: expected next token to be IDENT, got INT instead"}},
+		{"x = y = 1", []string{"1:7: no prefix parse function for = found"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expected) {
+			t.Fatalf("%q: wrong number of errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+
+		for i, msg := range tt.expected {
+			if errors[i] != msg {
+				t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, msg, errors[i])
+			}
+		}
+
+		if strings.Contains(tt.expected[0], "cannot assign") {
+			if kind := p.ParseErrors()[0].Kind; kind != ErrInvalidAssignment {
+				t.Errorf("%q: error kind wrong. got=%s", tt.input, kind)
+			}
+		}
+	}
+}
+
+func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, operator string, right interface{}) bool {
+
+	opExp, ok := exp.(*ast.InfixExpression)
+	if !ok {
+		t.Errorf("exp is not ast.OperatorExpression. got=%T(%s)", exp, exp)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Left, left) {
+		return false
+	}
+
+	if opExp.Operator != operator {
+		t.Errorf("exp.Operator is not '%s'. got=%q", operator, opExp.Operator)
+		return false
+	}
+
+	if !testLiteralExpression(t, opExp.Right, right) {
+		return false
+	}
+
+	return true
+}
+
+func testLiteralExpression(t *testing.T, exp ast.Expression, expected interface{}) bool {
+	switch v := expected.(type) {
+	case int:
+		return testIntegerLiteral(t, exp, int64(v))
+	case int64:
+		return testIntegerLiteral(t, exp, v)
+	case string:
+		return testIdentifier(t, exp, v)
+	case bool:
+		return testBooleanLiteral(t, exp, v)
+	}
+	t.Errorf("type of exp not handled. got=%T", exp)
+	return false
+}
+
+func testIdentifier(t *testing.T, exp ast.Expression, value string) bool {
+	ident, ok := exp.(*ast.Identifier)
+	if !ok {
+		t.Errorf("exp not *ast.Identifier. got=%T", exp)
+		return false
+	}
+
+	if ident.Value != value {
+		t.Errorf("ident.Value not %s. got=%s", value, ident.Value)
+		return false
+	}
+
+	if ident.TokenLiteral() != value {
+		t.Errorf("ident.TokenLiteral not %s. got=%s", value, ident.TokenLiteral())
+		return false
+	}
+
+	return true
+}
+
+func TestIfElseExpression(t *testing.T) {
+	input := `if (x < y) { x } else { y }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(exp.Consequence.Statements) != 1 {
+		t.Errorf("consequence is not 1 statements. got=%d\n",
+			len(exp.Consequence.Statements))
+	}
+
+	consequence, ok := exp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Consequence.Statements[0])
+	}
+
+	if !testIdentifier(t, consequence.Expression, "x") {
+		return
+	}
+
+	if len(exp.Alternative.Statements) != 1 {
+		t.Errorf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T",
+			exp.Alternative.Statements[0])
+	}
+
+	if !testIdentifier(t, alternative.Expression, "y") {
+		return
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0], "x")
+	testLiteralExpression(t, function.Parameters[1], "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+		expectedString string
+	}{
+		{input: "fn() {};", expectedParams: []string{}, expectedString: "fn() {}"},
+		{input: "fn(x) { x };", expectedParams: []string{"x"}, expectedString: "fn(x) { x }"},
+		{input: "fn(x, y, z) { x * y };", expectedParams: []string{"x", "y", "z"}, expectedString: "fn(x, y, z) { (x * y) }"},
+		{input: "fn(x, y,) { x };", expectedParams: []string{"x", "y"}, expectedString: "fn(x, y) { x }"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i], ident)
+		}
+
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. expected=%q, got=%q", tt.expectedString, function.String())
+		}
+
+		// String() の出力を再度構文解析しても同じ結果になる
+		p2 := New(lexer.New(function.String()))
+		reparsed := p2.ParseProgram()
+		checkParserErrors(t, p2)
+		if reparsed.String() != function.String() {
+			t.Errorf("round trip wrong. expected=%q, got=%q", function.String(), reparsed.String())
+		}
+	}
+}
+
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(1) {}", "1:4: expected next token to be IDENT, got INT instead"},
+		{"fn(x,,) {}", "1:6: expected next token to be IDENT, got , instead"},
+		{"fn(,) {}", "1:4: expected next token to be IDENT, got , instead"},
+		{"fn(x y) {}", "1:6: expected next token to be ), got IDENT instead"},
+		{"fn(x) x", "1:7: expected next token to be {, got IDENT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestChainedCallExpressionParsing(t *testing.T) {
+	input := "f(1)(2);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+	outer, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	inner, ok := outer.Function.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("outer.Function is not ast.CallExpression. got=%T", outer.Function)
+	}
+
+	testIdentifier(t, inner.Function, "f")
+	testLiteralExpression(t, inner.Arguments[0], 1)
+	testLiteralExpression(t, outer.Arguments[0], 2)
+}
+
+func TestCommentsIgnored(t *testing.T) {
+	input := `
+// 二つの数を足す
+let add = fn(a, b) {
+	a + b; /* 戻り値 */
+};
+add(1, /* 二つ目 */ 2) // 呼び出し
+`
+	for _, mode := range []lexer.Mode{0, lexer.ScanComments} {
+		l := lexer.New(input)
+		l.Mode = mode
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		expected := "let add = fn(a, b) { (a + b) };add(1, 2)"
+		if program.String() != expected {
+			t.Errorf("program.String() wrong. expected=%q, got=%q", expected, program.String())
+		}
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	input := `let x = 5;
+let y = fn(a, b {
+	a + b
+};
+`
+	l := lexer.NewFile("script.mk", input)
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "script.mk:2:17: expected next token to be ), got { instead"
+	if errors[0] != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errors[0])
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors int
+		expectedString string
+	}{
+		{"let = 5; let y = 10;", 1, "<bad statement>let y = 10;"},
+		{"let x 5; return 6", 1, "<bad statement>return 6;"},
+		{"let x = 1 + ; let y = 2;", 1, "let x = (1 + <bad expression>);let y = 2;"},
+		{"x + ) * 3; y", 1, "(x + <bad expression>)y"},
+		{"let f = fn() { 1 + }; let y = 2;", 1, "let f = fn() { (1 + <bad expression>) };let y = 2;"},
+		{"if (x) { -}; let y = 2;", 1, "ifx (-<bad expression>)let y = 2;"},
+		{"let a = [1, ]; let h = {1: }; let y = 2;", 1, "let a = [1];let h = {1: <bad expression>};let y = 2;"},
+		{"f(1, g(x * )); let y = 2;", 1, "f(1, g((x * <bad expression>)))let y = 2;"},
+		{"let f = fn() { (}; let y = 2;", 1, "let f = fn() { <bad expression> };let y = 2;"},
+		{"if (x { 1 } let y = 2;", 1, "<bad expression>let y = 2;"},
+		{"fn(x { let a = 1; a }; let z = 3;", 1, "<bad expression>let z = 3;"},
+		{"let a = fn(x) { let = 1; x }; a(1)", 1, "let a = fn(x) { <bad statement>x };a(1)"},
+		{"let = 1; let = 2; let = 3;", 3, "<bad statement><bad statement><bad statement>"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		if len(p.Errors()) != tt.expectedErrors {
+			t.Errorf("%q: wrong number of errors. expected=%d, got=%d %q",
+				tt.input, tt.expectedErrors, len(p.Errors()), p.Errors())
+		}
+
+		if program.String() != tt.expectedString {
+			t.Errorf("%q: program.String() wrong. expected=%q, got=%q",
+				tt.input, tt.expectedString, program.String())
+		}
+	}
+}
+
+func TestBadStatementPlaceholder(t *testing.T) {
+	input := `
+let x = 1;
+let = 2;
+let y = 3;
+`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	bad, ok := program.Statements[1].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.BadStatement. got=%T", program.Statements[1])
+	}
+
+	if bad.Token.Pos.Line != 3 || bad.Token.Pos.Column != 1 {
+		t.Errorf("bad.Token.Pos wrong. got=%s", bad.Token.Pos)
+	}
+
+	testLetStatement(t, program.Statements[0], "x")
+	testLetStatement(t, program.Statements[2], "y")
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	tests := []string{
+		"[1, 2 * 2, 3 + 3]",
+		"[1, 2 * 2, 3 + 3,]",
+		"[\n  1,\n  2 * 2,\n  3 + 3,\n]",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		array, ok := stmt.Expression.(*ast.ArrayLiteral)
+		if !ok {
+			t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(array.Elements) != 3 {
+			t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+		}
+
+		testIntegerLiteral(t, array.Elements[0], 1)
+		testInfixExpression(t, array.Elements[1], 2, "*", 2)
+		testInfixExpression(t, array.Elements[2], 3, "+", 3)
+
+		if array.String() != "[1, (2 * 2), (3 + 3)]" {
+			t.Errorf("array.String() wrong. got=%q", array.String())
+		}
+	}
+}
+
+func TestParsingEmptyArrayLiteral(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	l := lexer.New("myArray[1 + 1]")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestArrayAndIndexRoundTrip(t *testing.T) {
+	tests := []string{
+		"[1, [2, 3], []]",
+		"[1, 2, 3][0]",
+		"m[0][1]",
+		"[fn(x) { x }, f(1)[2]][0](3)",
+		"f(1, 2,)",
+	}
+
+	for _, input := range tests {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		p2 := New(lexer.New(program.String()))
+		reparsed := p2.ParseProgram()
+		checkParserErrors(t, p2)
+
+		if reparsed.String() != program.String() {
+			t.Errorf("round trip wrong for %q. expected=%q, got=%q", input, program.String(), reparsed.String())
+		}
+	}
+}
+
+func TestArrayErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2", "1:6: unexpected end of input, expected ]"},
+		{"[1 2]", "1:4: expected next token to be ], got INT instead"},
+		{"[1,,2]", "1:4: no prefix parse function for , found"},
+		{"a[1", "1:4: unexpected end of input, expected ]"},
+		{"a[]", "1:3: no prefix parse function for ] found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	// ソースに書かれた順に並ぶ
+	for i, tt := range expected {
+		literal, ok := hash.Pairs[i].Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", hash.Pairs[i].Key)
+			continue
+		}
+
+		if literal.Value != tt.key {
+			t.Errorf("hash.Pairs[%d].Key wrong. expected=%q, got=%q", i, tt.key, literal.Value)
+		}
+
+		testIntegerLiteral(t, hash.Pairs[i].Value, tt.value)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	l := lexer.New("{}")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{k: v, "one": 0 + 1, 1 + 1: 15 / 5, true: [1], f(x): {},}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 5 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	testIdentifier(t, hash.Pairs[0].Key, "k")
+	testIdentifier(t, hash.Pairs[0].Value, "v")
+	testInfixExpression(t, hash.Pairs[1].Value, 0, "+", 1)
+	testInfixExpression(t, hash.Pairs[2].Key, 1, "+", 1)
+	testInfixExpression(t, hash.Pairs[2].Value, 15, "/", 5)
+	testBooleanLiteral(t, hash.Pairs[3].Key, true)
+
+	if _, ok := hash.Pairs[4].Key.(*ast.CallExpression); !ok {
+		t.Errorf("hash.Pairs[4].Key is not ast.CallExpression. got=%T", hash.Pairs[4].Key)
+	}
+
+	expected := `{k: v, "one": (0 + 1), (1 + 1): (15 / 5), true: [1], f(x): {}}`
+	if hash.String() != expected {
+		t.Errorf("hash.String() wrong. expected=%q, got=%q", expected, hash.String())
+	}
+
+	p2 := New(lexer.New(hash.String()))
+	reparsed := p2.ParseProgram()
+	checkParserErrors(t, p2)
+	if reparsed.String() != expected {
+		t.Errorf("round trip wrong. expected=%q, got=%q", expected, reparsed.String())
+	}
+}
+
+func TestHashLiteralVersusBlock(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// fn や if の後ろの { はブロック、式の位置の { はハッシュ
+		{`fn() { {"a": 1} }`, `fn() { {"a": 1} }`},
+		{`fn() { {} }`, `fn() { {} }`},
+		{`let h = {"a": {"b": 2}}["a"]`, `let h = ({"a": {"b": 2}}["a"]);`},
+		{`f({1: 2})`, `f({1: 2})`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("program.String() wrong. expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`if (x) { {"a": 1} }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	ifExp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	consequence := ifExp.Consequence.Statements[0].(*ast.ExpressionStatement)
+	if _, ok := consequence.Expression.(*ast.HashLiteral); !ok {
+		t.Errorf("consequence is not ast.HashLiteral. got=%T", consequence.Expression)
+	}
+}
+
+func TestHashLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"a" 1}`, "1:6: expected next token to be :, got INT instead"},
+		{`{"a": 1 "b": 2}`, "1:9: expected next token to be ,, got STRING instead"},
+		{`{"a": 1,`, "1:9: unexpected end of input"},
+		{`{"a"`, "1:5: unexpected end of input, expected :"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 error, got %q", tt.input, errors)
+		}
+		if errors[0] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // 最初の文の範囲のソース
+	}{
+		{"let x = 5 * y;", "let x = 5 * y"},
+		{"return;", "return"},
+		{"return a + b; c", "return a + b"},
+		{"x += f(1, 2) ;", "x += f(1, 2)"},
+		{"h.list[0] = 1", "h.list[0] = 1"},
+		{"-a * (b + c)", "-a * (b + c)"},
+		{"(a + b) * c", "(a + b) * c"},
+		{"((a)) = 1", "((a)) = 1"},
+		{"(f)(x)[0]", "(f)(x)[0]"},
+		{"a && !b", "a && !b"},
+		{`"a\tb" + "c"`, `"a\tb" + "c"`},
+		{"if (x) { a } else if (y) { b } else { c }; d", "if (x) { a } else if (y) { b } else { c }"},
+		{"if (x) { a } else if (y) { b }", "if (x) { a } else if (y) { b }"},
+		{"if (x) { a }\nb", "if (x) { a }"},
+		{"fn(a, b) { return a; }(1, 2)", "fn(a, b) { return a; }(1, 2)"},
+		{"[1, 2, 3,][0]", "[1, 2, 3,][0]"},
+		{`{"a": 1, "b": 2}`, `{"a": 1, "b": 2}`},
+		{"while (x) { break; continue; }", "while (x) { break; continue; }"},
+		{"for (x in xs) {}", "for (x in xs) {}"},
+		{"true", "true"},
+		{"1.5e3", "1.5e3"},
+	}
+
+	for _, tt := range tests {
+		program := parseSource(t, tt.input)
+
+		stmt := program.Statements[0]
+		if source := tt.input[stmt.Pos().Offset:stmt.End().Offset]; source != tt.expected {
+			t.Errorf("%q: wrong range. expected=%q, got=%q", tt.input, tt.expected, source)
+		}
+	}
+}
+
+func TestNodePositionsNest(t *testing.T) {
+	input := `let f = fn(x, y) {
+	let h = {"k": [x, y][0], "v": -x ** 2};
+	while (x < 10) { x += 1; if (x == y) { break } else if (x > y) { continue } }
+	for (v in h.items) { h.total = h.total + v }
+	return h.k || false;
+};
+f(1, 2.5);`
+
+	program := parseSource(t, input)
+
+	var stack []ast.Node
+	ast.Inspect(program, func(n ast.Node) bool {
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+
+		pos, end := n.Pos(), n.End()
+		if !pos.IsValid() || !end.IsValid() || pos.Offset > end.Offset {
+			t.Errorf("%T %q has an invalid range %s-%s", n, n, pos, end)
+		}
+
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1]
+			if pos.Offset < parent.Pos().Offset || end.Offset > parent.End().Offset {
+				t.Errorf("%T %q (%s-%s) is outside of its parent %T (%s-%s)",
+					n, n, pos, end, parent, parent.Pos(), parent.End())
+			}
+		}
+
+		stack = append(stack, n)
+
+		return true
+	})
+
+	if end := program.End(); end.Offset != len(input)-1 || end.Line != 7 || end.Column != 10 {
+		t.Errorf("program.End() wrong. got=%s (offset %d)", end, end.Offset)
+	}
+}
+
+func TestProgramJSONRoundTrip(t *testing.T) {
+	input := `let f = fn(x, y) {
+	// 合計
+	let h = {"k": [x, y][0], "v": -x ** 2.5};
+	while (x < 10) { x += 1; if (x == y) { break } else if (x > y) { continue } else { x } }
+	for (v in h.items) { h.total = h.total + v }
+	return h.k || !false;
+};
+f(1, "two\n");`
+
+	l := lexer.NewFile("main.mk", input)
+	l.Mode = lexer.ScanComments
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	data, err := ast.MarshalJSON(program)
+	if err != nil {
+		t.Fatalf("MarshalJSON returned error: %v", err)
+	}
+
+	decoded, err := ast.UnmarshalJSON(data)
+	if err != nil {
+		t.Fatalf("UnmarshalJSON returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(decoded, program) {
+		t.Errorf("program changed after JSON round trip")
+	}
+
+	if decoded.String() != program.String() {
+		t.Errorf("decoded.String() wrong.\nexpected=%q\ngot=     %q", program.String(), decoded.String())
+	}
+}
+
+func parseSource(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	return program
+}
+
+func TestUnexpectedEndOfInput(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let", "1:4: unexpected end of input, expected IDENT"},
+		{"let x", "1:6: unexpected end of input, expected ="},
+		{"let x =", "1:8: unexpected end of input"},
+		{"-", "1:2: unexpected end of input"},
+		{"1 +", "1:4: unexpected end of input"},
+		{"(1 + 2", "1:7: unexpected end of input, expected )"},
+		{"if (x", "1:6: unexpected end of input, expected )"},
+		{"if (x) { 1", "1:11: unexpected end of input, expected }"},
+		{"if (x) { 1 } else", "1:18: unexpected end of input, expected {"},
+		{"fn(x, ", "1:7: unexpected end of input, expected IDENT"},
+		{"fn(x) { x", "1:10: unexpected end of input, expected }"},
+		{"add(1, 2", "1:9: unexpected end of input, expected )"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[len(errors)-1] != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, errors[len(errors)-1])
+		}
+	}
+}
+
+// 書きかけのバッファが渡されても ParseProgram は必ず終了し、panic しない
+func FuzzParseProgram(f *testing.F) {
+	seeds := []string{
+		"let x = 5 * y;",
+		"let x = 5",
+		"return;",
+		"return x",
+		"if (x < y) { x } else { y }",
+		"if (x < y) { x",
+		"-(5 + 5",
+		"!(true == ",
+		"let",
+		"fn(x, y) { x + y; }",
+		"fn(x, ",
+		"",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+			p := New(lexer.New(input))
+			program := p.ParseProgram()
+
+			// エラーがあっても木に nil は残らない
+			_ = program.String()
+			ast.Inspect(program, func(n ast.Node) bool {
+				if n != nil {
+					n.Pos()
+					n.End()
+				}
+
+				return true
+			})
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("ParseProgram did not terminate for %q", input)
+		}
+	})
+}
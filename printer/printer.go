@@ -0,0 +1,618 @@
+/*
+Package printer は構文木を Monkey のソースとして書き出す
+
+ast の String() はデバッグ用で、出力をそのまま構文解析器に戻すことはできない
+このパッケージの出力は構文解析器で読み直すと同じ構造の木になる
+
+  - 文は1行に1つ書き、ブロックの中はタブで字下げする
+  - 式文、let 文、return 文、代入文、break、continue の後ろには必ず「;」を付ける
+  - 括弧は優先順位と結合性から必要な所にだけ付ける
+  - 数値は値から書き直す (0x1F は 31 になる). コメントは出力しない
+*/
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/naronA/monkey/ast"
+)
+
+// Fprint は node を Monkey のソースとして output に書き出す
+// 構文エラーの跡 (BadStatement や BadExpression) や、なくてはならない子が nil のノードを含む木は
+// 書き出せず、エラーを返す
+func Fprint(output io.Writer, node ast.Node) error {
+	p := &printer{}
+	p.node(node)
+
+	if p.err != nil {
+		return p.err
+	}
+
+	_, err := output.Write(p.buf.Bytes())
+
+	return err
+}
+
+// Sprint は Fprint の結果を文字列で返す
+func Sprint(node ast.Node) (string, error) {
+	var buf bytes.Buffer
+	if err := Fprint(&buf, node); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// 式の優先順位. 構文解析器 (parser パッケージ) の優先順位と同じ順に並べる
+const (
+	precLowest = iota
+	precLogicalOr
+	precLogicalAnd
+	precEquals
+	precLessGreater
+	precSum
+	precProduct
+	precPrefix
+	precPower
+	precPostfix // 関数呼び出し、添字、フィールドアクセス
+	precPrimary // 識別子、リテラル、if、fn など括弧なしでどこにでも置ける式
+)
+
+var binaryPrecedences = map[string]int{
+	"||": precLogicalOr,
+	"&&": precLogicalAnd,
+	"==": precEquals,
+	"!=": precEquals,
+	"<":  precLessGreater,
+	">":  precLessGreater,
+	"<=": precLessGreater,
+	">=": precLessGreater,
+	"+":  precSum,
+	"-":  precSum,
+	"|":  precSum,
+	"^":  precSum,
+	"*":  precProduct,
+	"/":  precProduct,
+	"%":  precProduct,
+	"&":  precProduct,
+	"<<": precProduct,
+	">>": precProduct,
+	"**": precPower,
+}
+
+type printer struct {
+	buf    bytes.Buffer
+	indent int
+	err    error
+}
+
+func (p *printer) print(s string) {
+	p.buf.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.buf.WriteByte('\n')
+	p.buf.WriteString(strings.Repeat("\t", p.indent))
+}
+
+func (p *printer) fail(node ast.Node) {
+	if p.err == nil {
+		p.err = fmt.Errorf("printer: cannot print %T", node)
+	}
+}
+
+// missing は parent の子 child が nil かどうかを返す. nil なら書き出せないのでエラーにする
+func (p *printer) missing(parent ast.Node, field string, child ast.Node) bool {
+	if !isNil(child) {
+		return false
+	}
+
+	if p.err == nil {
+		p.err = fmt.Errorf("printer: cannot print %T with nil %s", parent, field)
+	}
+
+	return true
+}
+
+func (p *printer) node(node ast.Node) {
+	if isNil(node) {
+		p.fail(node)
+		return
+	}
+
+	switch n := node.(type) {
+	case *ast.Program:
+		for i, stmt := range n.Statements {
+			if p.missing(n, "Statements", stmt) {
+				return
+			}
+
+			p.statement(stmt)
+			p.terminate(n.Statements, i)
+			p.print("\n")
+		}
+	case *ast.BlockStatement:
+		p.block(n)
+	case *ast.ElseIf:
+		p.elseIf(n)
+	case ast.Statement:
+		p.statement(n)
+	case ast.Expression:
+		p.expression(n, precLowest)
+	default:
+		p.fail(node)
+	}
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		if p.missing(s, "Name", s.Name) || p.missing(s, "Value", s.Value) {
+			return
+		}
+
+		p.print("let " + s.Name.Value + " = ")
+		p.expression(s.Value, precLowest)
+		p.print(";")
+
+	case *ast.AssignStatement:
+		if p.missing(s, "Target", s.Target) || p.missing(s, "Value", s.Value) {
+			return
+		}
+
+		p.expression(s.Target, precLowest)
+		p.print(" " + s.Operator + " ")
+		p.expression(s.Value, precLowest)
+		p.print(";")
+
+	case *ast.ReturnStatement:
+		p.print("return")
+		if !isNil(s.ReturnValue) {
+			p.print(" ")
+			p.expression(s.ReturnValue, precLowest)
+		}
+		p.print(";")
+
+	case *ast.ExpressionStatement:
+		if p.missing(s, "Expression", s.Expression) {
+			return
+		}
+
+		// if 式の後ろの「;」は terminate が付ける
+		p.expression(s.Expression, precLowest)
+		if _, ok := unparen(s.Expression).(*ast.IfExpression); !ok {
+			p.print(";")
+		}
+
+	case *ast.BlockStatement:
+		p.block(s)
+
+	case *ast.WhileStatement:
+		if p.missing(s, "Condition", s.Condition) || p.missing(s, "Body", s.Body) {
+			return
+		}
+
+		p.print("while (")
+		p.expression(s.Condition, precLowest)
+		p.print(") ")
+		p.block(s.Body)
+
+	case *ast.ForStatement:
+		if p.missing(s, "Variable", s.Variable) || p.missing(s, "Iterable", s.Iterable) || p.missing(s, "Body", s.Body) {
+			return
+		}
+
+		p.print("for (" + s.Variable.Value + " in ")
+		p.expression(s.Iterable, precLowest)
+		p.print(") ")
+		p.block(s.Body)
+
+	case *ast.BreakStatement:
+		p.print("break;")
+
+	case *ast.ContinueStatement:
+		p.print("continue;")
+
+	default:
+		p.fail(stmt)
+	}
+}
+
+func (p *printer) block(block *ast.BlockStatement) {
+	if len(block.Statements) == 0 {
+		p.print("{}")
+		return
+	}
+
+	p.print("{")
+	p.indent++
+
+	for i, stmt := range block.Statements {
+		if p.missing(block, "Statements", stmt) {
+			return
+		}
+
+		p.newline()
+		p.statement(stmt)
+		p.terminate(block.Statements, i)
+	}
+
+	p.indent--
+	p.newline()
+	p.print("}")
+}
+
+/*
+terminate は if 式の文 list[i] の後ろに、必要なら「;」を付ける
+if 式の後ろに ( や [ や - で始まる文が続くと、呼び出しや添字や引き算として if 式の続きに読まれてしまう
+*/
+func (p *printer) terminate(list []ast.Statement, i int) {
+	stmt, ok := list[i].(*ast.ExpressionStatement)
+	if !ok {
+		return
+	}
+
+	if _, ok := unparen(stmt.Expression).(*ast.IfExpression); !ok {
+		return
+	}
+
+	if i+1 < len(list) && continues(list[i+1]) {
+		p.print(";")
+	}
+}
+
+// continues は文が前の式の続きとして読まれうる記号で始まるかどうかを返す
+func continues(stmt ast.Statement) bool {
+	if isNil(stmt) {
+		return false
+	}
+
+	switch s := stmt.(type) {
+	case *ast.ExpressionStatement:
+		return startsWithOperator(s.Expression, precLowest)
+	case *ast.AssignStatement:
+		return startsWithOperator(s.Target, precLowest)
+	}
+
+	return false
+}
+
+// startsWithOperator は expression(exp, min) が書き出す最初の文字が ( や [ や - かどうかを返す
+func startsWithOperator(exp ast.Expression, min int) bool {
+	if isNil(exp) {
+		return false
+	}
+
+	if precedence(exp) < min {
+		return true
+	}
+
+	switch e := exp.(type) {
+	case *ast.ParenExpression:
+		return startsWithOperator(e.Expression, min)
+	case *ast.PrefixExpression:
+		return e.Operator == "-"
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		return negative(e)
+	case *ast.InfixExpression:
+		return startsWithOperator(e.Left, leftPrecedence(e.Operator))
+	case *ast.LogicalExpression:
+		return startsWithOperator(e.Left, leftPrecedence(e.Operator))
+	case *ast.CallExpression:
+		return startsWithOperator(e.Function, precPostfix)
+	case *ast.IndexExpression:
+		return startsWithOperator(e.Left, precPostfix)
+	case *ast.FieldExpression:
+		return startsWithOperator(e.Left, precPostfix)
+	case *ast.ArrayLiteral:
+		return true
+	}
+
+	return false
+}
+
+func (p *printer) elseIf(clause *ast.ElseIf) {
+	if p.missing(clause, "Condition", clause.Condition) || p.missing(clause, "Consequence", clause.Consequence) {
+		return
+	}
+
+	p.print("else if (")
+	p.expression(clause.Condition, precLowest)
+	p.print(") ")
+	p.block(clause.Consequence)
+}
+
+// precedence は式を括弧なしで置ける最も強い結合の優先順位を返す
+func precedence(exp ast.Expression) int {
+	exp = unparen(exp)
+	if isNil(exp) {
+		return precPrimary
+	}
+
+	switch e := exp.(type) {
+	case *ast.InfixExpression:
+		return binaryPrecedence(e.Operator)
+	case *ast.LogicalExpression:
+		return binaryPrecedence(e.Operator)
+	case *ast.PrefixExpression:
+		return precPrefix
+	case *ast.CallExpression, *ast.IndexExpression, *ast.FieldExpression:
+		return precPostfix
+	case *ast.IntegerLiteral, *ast.FloatLiteral:
+		// 負の数は「-」と数値に読まれるので前置演算子と同じ扱いにする
+		if negative(e) {
+			return precPrefix
+		}
+	}
+
+	return precPrimary
+}
+
+// binaryPrecedence は二項演算子の優先順位を返す
+// 構文解析器のオプションで追加した演算子は優先順位が分からないので、常に括弧でくくる
+func binaryPrecedence(operator string) int {
+	if prec, ok := binaryPrecedences[operator]; ok {
+		return prec
+	}
+
+	return precLowest
+}
+
+// expression は式を書き出す. 式の優先順位が min より弱ければ括弧でくくる
+// ソースにあった括弧 (ParenExpression) は書き出さず、必要かどうかを改めて決める
+func (p *printer) expression(exp ast.Expression, min int) {
+	exp = unparen(exp)
+
+	if precedence(exp) < min {
+		p.print("(")
+		defer p.print(")")
+	}
+
+	switch e := exp.(type) {
+	case *ast.ParenExpression:
+		// unparen が括弧を外さないのは中の式が nil のときだけ
+		p.missing(e, "Expression", e.Expression)
+
+	case *ast.Identifier:
+		p.print(e.Value)
+
+	case *ast.IntegerLiteral:
+		// -9223372036854775808 は 9223372036854775808 が範囲外なので読み直せない
+		if e.Value == math.MinInt64 {
+			p.fail(e)
+			return
+		}
+
+		p.print(strconv.FormatInt(e.Value, 10))
+
+	case *ast.FloatLiteral:
+		// 無限大と NaN を表すリテラルはない
+		if math.IsInf(e.Value, 0) || math.IsNaN(e.Value) {
+			p.fail(e)
+			return
+		}
+
+		p.print(formatFloat(e.Value))
+
+	case *ast.StringLiteral:
+		// String() は字句解析器が読めるエスケープだけを使ってクォートする
+		p.print(e.String())
+
+	case *ast.Boolean:
+		p.print(strconv.FormatBool(e.Value))
+
+	case *ast.PrefixExpression:
+		if p.missing(e, "Right", e.Right) {
+			return
+		}
+
+		p.print(e.Operator)
+		p.expression(e.Right, precPrefix)
+
+	case *ast.InfixExpression:
+		p.binary(e, e.Left, e.Operator, e.Right)
+
+	case *ast.LogicalExpression:
+		p.binary(e, e.Left, e.Operator, e.Right)
+
+	case *ast.IfExpression:
+		if p.missing(e, "Condition", e.Condition) || p.missing(e, "Consequence", e.Consequence) {
+			return
+		}
+
+		p.print("if (")
+		p.expression(e.Condition, precLowest)
+		p.print(") ")
+		p.block(e.Consequence)
+
+		for _, clause := range e.ElseIfs {
+			if p.missing(e, "ElseIfs", clause) {
+				return
+			}
+
+			p.print(" ")
+			p.elseIf(clause)
+		}
+
+		if e.Alternative != nil {
+			p.print(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.FunctionLiteral:
+		if p.missing(e, "Body", e.Body) {
+			return
+		}
+
+		params := make([]string, len(e.Parameters))
+		for i, param := range e.Parameters {
+			if p.missing(e, "Parameters", param) {
+				return
+			}
+
+			params[i] = param.Value
+		}
+
+		p.print("fn(" + strings.Join(params, ", ") + ") ")
+		p.block(e.Body)
+
+	case *ast.CallExpression:
+		if p.missing(e, "Function", e.Function) {
+			return
+		}
+
+		p.expression(e.Function, precPostfix)
+		p.print("(")
+		p.expressionList(e, "Arguments", e.Arguments)
+		p.print(")")
+
+	case *ast.ArrayLiteral:
+		p.print("[")
+		p.expressionList(e, "Elements", e.Elements)
+		p.print("]")
+
+	case *ast.IndexExpression:
+		if p.missing(e, "Left", e.Left) || p.missing(e, "Index", e.Index) {
+			return
+		}
+
+		p.expression(e.Left, precPostfix)
+		p.print("[")
+		p.expression(e.Index, precLowest)
+		p.print("]")
+
+	case *ast.FieldExpression:
+		if p.missing(e, "Left", e.Left) || p.missing(e, "Field", e.Field) {
+			return
+		}
+
+		p.expression(e.Left, precPostfix)
+		p.print("." + e.Field.Value)
+
+	case *ast.HashLiteral:
+		p.print("{")
+		for i, pair := range e.Pairs {
+			if p.missing(e, "Pairs", pair.Key) || p.missing(e, "Pairs", pair.Value) {
+				return
+			}
+
+			if i > 0 {
+				p.print(", ")
+			}
+
+			p.expression(pair.Key, precLowest)
+			p.print(": ")
+			p.expression(pair.Value, precLowest)
+		}
+		p.print("}")
+
+	default:
+		p.fail(exp)
+	}
+}
+
+// unparen は exp を囲む括弧を全て外した式を返す
+func unparen(exp ast.Expression) ast.Expression {
+	for {
+		paren, ok := exp.(*ast.ParenExpression)
+		if !ok || isNil(paren) || isNil(paren.Expression) {
+			return exp
+		}
+
+		exp = paren.Expression
+	}
+}
+
+// isNil は node が nil か、nil のポインタを入れたインタフェースかどうかを返す
+func isNil(node ast.Node) bool {
+	if node == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(node)
+
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+func (p *printer) binary(parent ast.Expression, left ast.Expression, operator string, right ast.Expression) {
+	if p.missing(parent, "Left", left) || p.missing(parent, "Right", right) {
+		return
+	}
+
+	p.expression(left, leftPrecedence(operator))
+	p.print(" " + operator + " ")
+	p.expression(right, rightPrecedence(operator))
+}
+
+/*
+leftPrecedence と rightPrecedence は二項演算子の左辺と右辺に括弧なしで置ける式の優先順位の下限を返す
+左結合の演算子では右辺に、右結合の ** では左辺に、同じ優先順位の式が来たら括弧が要る
+優先順位の分からない演算子では、両辺が単純な式でなければ括弧でくくる
+*/
+func leftPrecedence(operator string) int {
+	prec := binaryPrecedence(operator)
+
+	switch {
+	case prec == precLowest:
+		return precPostfix
+	case operator == "**":
+		return prec + 1
+	}
+
+	return prec
+}
+
+func rightPrecedence(operator string) int {
+	prec := binaryPrecedence(operator)
+
+	switch {
+	case prec == precLowest:
+		return precPostfix
+	case operator == "**":
+		return prec
+	}
+
+	return prec + 1
+}
+
+func (p *printer) expressionList(parent ast.Expression, field string, list []ast.Expression) {
+	for i, exp := range list {
+		if p.missing(parent, field, exp) {
+			return
+		}
+
+		if i > 0 {
+			p.print(", ")
+		}
+
+		p.expression(exp, precLowest)
+	}
+}
+
+// negative は数値リテラルが負の数 (-0.0 を含む) かどうかを返す. 構文解析器は作らないが ast.Modify などで作れる
+func negative(exp ast.Expression) bool {
+	switch e := exp.(type) {
+	case *ast.IntegerLiteral:
+		return e.Value < 0
+	case *ast.FloatLiteral:
+		return math.Signbit(e.Value)
+	}
+
+	return false
+}
+
+// formatFloat は値を正確に表す最短の表記を返す. 整数に見えるときは字句解析器が FLOAT と読むように .0 を付ける
+func formatFloat(value float64) string {
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
@@ -0,0 +1,462 @@
+package printer
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/naronA/monkey/ast"
+	"github.com/naronA/monkey/lexer"
+	"github.com/naronA/monkey/mtoken"
+	"github.com/naronA/monkey/parser"
+)
+
+// 往復のテストに使うソース. ファズテストの種にもなる
+var roundTripSources = []string{
+	"let x = 5 * y;",
+	"return;",
+	"return a + b * c",
+	"x += 1; a[i] -= 2; h.name = \"monkey\"; h.list[0].n *= 3; y /= 4",
+	"-a * b; !-a; --a; -(a + b); -a ** 2; (-a) ** 2; a ** b ** c; (a ** b) ** c",
+	"a + b + c; a + (b + c); a - (b - c); (a - b) - c; a * (b + c) / d % e",
+	"a < b == c > d; a <= b != (c >= d); (a == b) == c; a == (b == c)",
+	"a || b && c; (a || b) && c; !(a && b) || c; a && (b && c)",
+	"a & b | c ^ d << 1 >> 2; ~a & ~(b | c); (a | b) & c",
+	"add(a, b)(c)[0].x; (a + b)(c); (-f)(x); -f(x); f(a + b, fn(x) { x; })",
+	"if (x < y) { x } else { y }",
+	"if (a) { 1 } else if (b) { 2 } else if (c) { 3 } else { 4 }; if (d) { 5 } else if (e) { 6 }",
+	"let v = if (a) { b } else { c }; if (a) { b }(c); if (x) {} else {}",
+	"let f = fn(x, y) { let z = x + y; return fn() { z }; }; fn() {}(); fn(x) { x }(5)",
+	"[1, 2 * 3, [4], []][0]; {\"a\": 1, 2: [3], true: fn() {}, \"n\": {}}[\"a\"]; {}",
+	"\"\\t\\\"quoted\\\"\\n\\\\\"; \"日本語\"; \"\\u{7f}\"",
+	"0x1F + 0o17 + 0b1010 + 1_000; 1.5 + 0.25 + 1e10 + 2.5E-3 + 3.0; 1.x; 2.5.y",
+	"while (x < 10) { x += 1; if (x == 5) { continue; } if (x == 8) { break } }",
+	"for (x in [1, 2, 3]) { for (y in h.items) { total = total + x * y; } }; while (true) {}",
+	"if (a) { b }; (c)(d); if (a) { b }; -c; if (a) { b }; [c]; if (a) { b } - c; if (a) { b }[0]",
+	"let nested = fn(a) { if (a) { while (a) { for (b in a) { if (b) { return b; } else { break; } } } } };",
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser has %d errors for %q: %q", len(p.Errors()), input, p.Errors())
+	}
+
+	return program
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, src := range roundTripSources {
+		testRoundTrip(t, src)
+	}
+}
+
+func testRoundTrip(t *testing.T, src string) {
+	t.Helper()
+
+	program := parse(t, src)
+
+	printed, err := Sprint(program)
+	if err != nil {
+		t.Fatalf("Sprint(%q) returned error: %v", src, err)
+	}
+
+	reparsed := parse(t, printed)
+	if !sameTree(reflect.ValueOf(program), reflect.ValueOf(reparsed)) {
+		t.Fatalf("tree changed after printing %q as\n%s", src, printed)
+	}
+
+	// 読み直した木を書き出しても同じソースになる
+	again, err := Sprint(reparsed)
+	if err != nil {
+		t.Fatalf("Sprint(%q) returned error: %v", printed, err)
+	}
+
+	if again != printed {
+		t.Errorf("printing is not stable.\nfirst:\n%s\nsecond:\n%s", printed, again)
+	}
+}
+
+// sameTree はトークンと位置と括弧 (ParenExpression) を無視して2つの木を比べる
+func sameTree(a, b reflect.Value) bool {
+	a, b = unparenValue(a), unparenValue(b)
+
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a.Type() {
+	case reflect.TypeOf(mtoken.Token{}), reflect.TypeOf(mtoken.Position{}):
+		return true
+	}
+
+	switch a.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+
+		return sameTree(a.Elem(), b.Elem())
+
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+
+		for i := 0; i < a.Len(); i++ {
+			if !sameTree(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+
+		return true
+
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			if !sameTree(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a.Interface() == b.Interface()
+}
+
+func unparenValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		paren, ok := v.Interface().(*ast.ParenExpression)
+		if !ok || paren == nil {
+			break
+		}
+
+		v = reflect.ValueOf(&paren.Expression).Elem()
+	}
+
+	return v
+}
+
+func TestFprint(t *testing.T) {
+	input := `let max = fn(a, b) { if (a > b) { a } else if (a == b) { return a; } else { b } };
+let counts = {"a": 1, "b": [1, 2]};
+while (i < 10) { i += 1; for (x in xs) { if (x) { break; } } }
+max(1, 2)`
+
+	expected := `let max = fn(a, b) {
+	if (a > b) {
+		a;
+	} else if (a == b) {
+		return a;
+	} else {
+		b;
+	}
+};
+let counts = {"a": 1, "b": [1, 2]};
+while (i < 10) {
+	i += 1;
+	for (x in xs) {
+		if (x) {
+			break;
+		}
+	}
+}
+max(1, 2);
+`
+
+	var out strings.Builder
+	if err := Fprint(&out, parse(t, input)); err != nil {
+		t.Fatalf("Fprint returned error: %v", err)
+	}
+
+	if out.String() != expected {
+		t.Errorf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestParentheses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(a + b) + c", "a + b + c;\n"},
+		{"a + (b + c)", "a + (b + c);\n"},
+		{"((a * b)) + c", "a * b + c;\n"},
+		{"(a + b) * c", "(a + b) * c;\n"},
+		{"a ** (b ** c)", "a ** b ** c;\n"},
+		{"(a ** b) ** c", "(a ** b) ** c;\n"},
+		{"-(a ** b)", "-a ** b;\n"},
+		{"(-a) ** b", "(-a) ** b;\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"(f)(x)", "f(x);\n"},
+		{"(a + b)[0]", "(a + b)[0];\n"},
+		{"(a || b) && c", "(a || b) && c;\n"},
+		{"(fn(x) { x })(1)", "fn(x) {\n\tx;\n}(1);\n"},
+		{"(if (a) { b })", "if (a) {\n\tb;\n}\n"},
+	}
+
+	for _, tt := range tests {
+		printed, err := Sprint(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("Sprint(%q) returned error: %v", tt.input, err)
+		}
+
+		if printed != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, printed)
+		}
+	}
+
+	// 負の数のリテラルは構文解析器は作らないが ast.Modify などで作れる
+	minusTwo := &ast.IntegerLiteral{Value: -2}
+	two := &ast.IntegerLiteral{Value: 2}
+	f := &ast.Identifier{Value: "f"}
+
+	nodes := []struct {
+		node     ast.Expression
+		expected string
+	}{
+		{&ast.InfixExpression{Left: minusTwo, Operator: "**", Right: two}, "(-2) ** 2"},
+		{&ast.InfixExpression{Left: two, Operator: "**", Right: minusTwo}, "2 ** (-2)"},
+		{&ast.InfixExpression{Left: minusTwo, Operator: "*", Right: two}, "-2 * 2"},
+		{&ast.FieldExpression{Left: minusTwo, Field: f}, "(-2).f"},
+		{&ast.IndexExpression{Left: &ast.FloatLiteral{Value: -1.5}, Index: two}, "(-1.5)[2]"},
+		{&ast.CallExpression{Function: f, Arguments: []ast.Expression{minusTwo}}, "f(-2)"},
+		{&ast.PrefixExpression{Operator: "-", Right: minusTwo}, "--2"},
+		{&ast.InfixExpression{Left: &ast.FloatLiteral{Value: math.Copysign(0, -1)}, Operator: "**", Right: two}, "(-0.0) ** 2"},
+	}
+
+	for _, tt := range nodes {
+		printed, err := Sprint(tt.node)
+		if err != nil {
+			t.Fatalf("Sprint(%T) returned error: %v", tt.node, err)
+		}
+
+		if printed != tt.expected {
+			t.Errorf("Sprint(%T): expected=%q, got=%q", tt.node, tt.expected, printed)
+		}
+	}
+}
+
+func TestIfStatementSemicolon(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"if (a) { b }; c", "if (a) {\n\tb;\n}\nc;\n"},
+		{"if (a) { b }; let c = 1", "if (a) {\n\tb;\n}\nlet c = 1;\n"},
+		{"if (a) { b }; (c)", "if (a) {\n\tb;\n}\nc;\n"},
+		{"if (a) { b }; (c + d) * e", "if (a) {\n\tb;\n};\n(c + d) * e;\n"},
+		{"if (a) { b }; -c", "if (a) {\n\tb;\n};\n-c;\n"},
+		{"if (a) { b }; !c", "if (a) {\n\tb;\n}\n!c;\n"},
+		{"if (a) { b }; [c][0] = 1", "if (a) {\n\tb;\n};\n[c][0] = 1;\n"},
+		{"if (a) { b }; (-c).d", "if (a) {\n\tb;\n};\n(-c).d;\n"},
+		{"if (a) { b }; -c ** 2 + d", "if (a) {\n\tb;\n};\n-c ** 2 + d;\n"},
+		{"if (a) { b }; c(-d)", "if (a) {\n\tb;\n}\nc(-d);\n"},
+	}
+
+	for _, tt := range tests {
+		printed, err := Sprint(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("Sprint(%q) returned error: %v", tt.input, err)
+		}
+
+		if printed != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, printed)
+		}
+
+		testRoundTrip(t, tt.input)
+	}
+
+	program := parse(t, "if (a) { b }")
+	program.Statements = append(program.Statements, &ast.ExpressionStatement{Expression: &ast.IntegerLiteral{Value: -1}})
+
+	printed, err := Sprint(program)
+	if err != nil {
+		t.Fatalf("Sprint returned error: %v", err)
+	}
+
+	if expected := "if (a) {\n\tb;\n};\n-1;\n"; printed != expected {
+		t.Errorf("expected=%q, got=%q", expected, printed)
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"0x1F", "31;\n"},
+		{"1_000", "1000;\n"},
+		{"3.0", "3.0;\n"},
+		{"1.5e3", "1500.0;\n"},
+		{"1e100", "1e+100;\n"},
+		{"0.000001", "1e-06;\n"},
+	}
+
+	for _, tt := range tests {
+		printed, err := Sprint(parse(t, tt.input))
+		if err != nil {
+			t.Fatalf("Sprint(%q) returned error: %v", tt.input, err)
+		}
+
+		if printed != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, printed)
+		}
+	}
+}
+
+func TestCustomOperator(t *testing.T) {
+	// 構文解析器のオプションで追加した演算子は優先順位が分からないので括弧でくくる
+	x, xs := &ast.Identifier{Value: "x"}, &ast.Identifier{Value: "xs"}
+	in := &ast.InfixExpression{Left: &ast.InfixExpression{Left: x, Operator: "+", Right: x}, Operator: "in", Right: xs}
+	exp := &ast.PrefixExpression{Operator: "!", Right: in}
+
+	printed, err := Sprint(exp)
+	if err != nil {
+		t.Fatalf("Sprint returned error: %v", err)
+	}
+
+	if printed != "!((x + x) in xs)" {
+		t.Errorf("wrong output. got=%q", printed)
+	}
+}
+
+func TestFprintNodes(t *testing.T) {
+	program := parse(t, "if (a) { b } else if (c) { d }")
+	ifExp := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{ifExp, "if (a) {\n\tb;\n} else if (c) {\n\td;\n}"},
+		{ifExp.Consequence, "{\n\tb;\n}"},
+		{ifExp.ElseIfs[0], "else if (c) {\n\td;\n}"},
+		{ifExp.Condition, "a"},
+		{&ast.Program{}, ""},
+	}
+
+	for _, tt := range tests {
+		printed, err := Sprint(tt.node)
+		if err != nil {
+			t.Fatalf("Sprint(%T) returned error: %v", tt.node, err)
+		}
+
+		if printed != tt.expected {
+			t.Errorf("Sprint(%T): expected=%q, got=%q", tt.node, tt.expected, printed)
+		}
+	}
+}
+
+func TestFprintBadNodes(t *testing.T) {
+	p := parser.New(lexer.New("let x = 1; let = 2; f(x"))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+
+	var out strings.Builder
+	err := Fprint(&out, program)
+	if err == nil {
+		t.Fatalf("Fprint did not return an error for a tree with syntax errors")
+	}
+
+	if err.Error() != "printer: cannot print *ast.BadStatement" {
+		t.Errorf("wrong error. got=%q", err)
+	}
+
+	if out.Len() != 0 {
+		t.Errorf("Fprint wrote output on error: %q", out.String())
+	}
+}
+
+func TestFprintNilChildren(t *testing.T) {
+	x := &ast.Identifier{Value: "x"}
+	one := &ast.IntegerLiteral{Value: 1}
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{&ast.Program{Statements: []ast.Statement{nil}}, "printer: cannot print *ast.Program with nil Statements"},
+		{&ast.LetStatement{Value: one}, "printer: cannot print *ast.LetStatement with nil Name"},
+		{&ast.LetStatement{Name: x}, "printer: cannot print *ast.LetStatement with nil Value"},
+		{&ast.AssignStatement{Target: x, Operator: "="}, "printer: cannot print *ast.AssignStatement with nil Value"},
+		{&ast.ExpressionStatement{}, "printer: cannot print *ast.ExpressionStatement with nil Expression"},
+		{&ast.ExpressionStatement{Expression: (*ast.Identifier)(nil)}, "printer: cannot print *ast.ExpressionStatement with nil Expression"},
+		{&ast.ReturnStatement{ReturnValue: (*ast.Identifier)(nil)}, "return;"},
+		{&ast.WhileStatement{Condition: x}, "printer: cannot print *ast.WhileStatement with nil Body"},
+		{&ast.ForStatement{Iterable: x, Body: &ast.BlockStatement{}}, "printer: cannot print *ast.ForStatement with nil Variable"},
+		{&ast.BlockStatement{Statements: []ast.Statement{(*ast.BreakStatement)(nil)}}, "printer: cannot print *ast.BlockStatement with nil Statements"},
+		{&ast.IfExpression{Condition: x}, "printer: cannot print *ast.IfExpression with nil Consequence"},
+		{&ast.IfExpression{Condition: x, Consequence: &ast.BlockStatement{}, ElseIfs: []*ast.ElseIf{{Condition: x}}},
+			"printer: cannot print *ast.ElseIf with nil Consequence"},
+		{&ast.FunctionLiteral{Parameters: []*ast.Identifier{x}}, "printer: cannot print *ast.FunctionLiteral with nil Body"},
+		{&ast.FunctionLiteral{Parameters: []*ast.Identifier{nil}, Body: &ast.BlockStatement{}}, "printer: cannot print *ast.FunctionLiteral with nil Parameters"},
+		{&ast.PrefixExpression{Operator: "-"}, "printer: cannot print *ast.PrefixExpression with nil Right"},
+		{&ast.InfixExpression{Left: x, Operator: "+"}, "printer: cannot print *ast.InfixExpression with nil Right"},
+		{&ast.LogicalExpression{Operator: "&&", Right: x}, "printer: cannot print *ast.LogicalExpression with nil Left"},
+		{&ast.ParenExpression{}, "printer: cannot print *ast.ParenExpression with nil Expression"},
+		{&ast.CallExpression{Arguments: []ast.Expression{x}}, "printer: cannot print *ast.CallExpression with nil Function"},
+		{&ast.CallExpression{Function: x, Arguments: []ast.Expression{nil}}, "printer: cannot print *ast.CallExpression with nil Arguments"},
+		{&ast.ArrayLiteral{Elements: []ast.Expression{one, nil}}, "printer: cannot print *ast.ArrayLiteral with nil Elements"},
+		{&ast.IndexExpression{Left: x}, "printer: cannot print *ast.IndexExpression with nil Index"},
+		{&ast.FieldExpression{Left: x}, "printer: cannot print *ast.FieldExpression with nil Field"},
+		{&ast.HashLiteral{Pairs: []ast.HashPair{{Key: x}}}, "printer: cannot print *ast.HashLiteral with nil Pairs"},
+		{(*ast.Program)(nil), "printer: cannot print *ast.Program"},
+		{nil, "printer: cannot print <nil>"},
+		{valueNode{}, "printer: cannot print printer.valueNode"},
+		{&ast.IntegerLiteral{Value: math.MinInt64}, "printer: cannot print *ast.IntegerLiteral"},
+	}
+
+	for _, tt := range tests {
+		printed, err := Sprint(tt.node)
+
+		got := printed
+		if err != nil {
+			got = err.Error()
+		}
+
+		if got != tt.expected {
+			t.Errorf("Sprint(%T): expected=%q, got=%q", tt.node, tt.expected, got)
+		}
+	}
+
+	// if 式の次の文に nil があっても「;」を付けるかどうかの判定で panic しない
+	program := parse(t, "if (a) { b }")
+	program.Statements = append(program.Statements, &ast.ExpressionStatement{Expression: (*ast.PrefixExpression)(nil)})
+
+	if _, err := Sprint(program); err == nil {
+		t.Errorf("Sprint did not return an error for a nil expression")
+	}
+}
+
+// valueNode はポインタでない ast.Node
+type valueNode struct{}
+
+func (valueNode) TokenLiteral() string { return "" }
+func (valueNode) String() string       { return "" }
+func (valueNode) Pos() mtoken.Position { return mtoken.Position{} }
+func (valueNode) End() mtoken.Position { return mtoken.Position{} }
+
+func FuzzRoundTrip(f *testing.F) {
+	for _, src := range roundTripSources {
+		f.Add(src)
+	}
+
+	f.Fuzz(func(t *testing.T, src string) {
+		// 構文エラーのある入力は往復の対象外
+		p := parser.New(lexer.New(src))
+		if p.ParseProgram(); len(p.Errors()) != 0 {
+			return
+		}
+
+		testRoundTrip(t, src)
+	})
+}